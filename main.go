@@ -3,21 +3,28 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
-	"encoding/base64"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
 	"math"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"reflect"
 	"regexp"
@@ -25,50 +32,74 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
+	"github.com/Sorrow446/Nugs-Downloader/nugs"
 	"github.com/alexflint/go-arg"
 	"github.com/dustin/go-humanize"
 	"github.com/grafov/m3u8"
 )
 
 const (
-	devKey         = "x7f54tgbdyc64y656thy47er4"
-	clientId       = "Eg7HuH873H65r5rt325UytR5429"
 	layout         = "01/02/2006 15:04:05"
-	userAgent      = "NugsNet/3.26.724 (Android; 7.1.2; Asus; ASUS_Z01QD; Scale/2.0; en)"
-	userAgentTwo   = "nugsnetAndroid"
-	authUrl        = "https://id.nugs.net/connect/token"
-	streamApiBase  = "https://streamapi.nugs.net/"
-	subInfoUrl     = "https://subscriptions.nugs.net/api/v1/me/subscriptions"
-	userInfoUrl    = "https://id.nugs.net/connect/userinfo"
 	playerUrl      = "https://play.nugs.net/"
+	imgBase        = "https://secure.livedownloads.com"
 	sanRegexStr    = `[\/:*?"><|]`
 	chapsFileFname = "chapters_nugs_dl_tmp.txt"
+	vidAudioFname  = "video_audio_nugs_dl_tmp.m4a"
+	upgradeTmpName = "upgrade_nugs_dl_tmp"
+	rawMetaFname   = "nugs_meta.json"
+	plistStateName = "nugs_playlist.json"
+	tagTmpName     = "tag_nugs_dl_tmp"
+	scheduleLayout = "Mon 02 Jan 2006 15:04 MST"
 	durRegex       = `Duration: ([\d:.]+)`
 	bitrateRegex   = `[\w]+(?:_(\d+)k_v\d+)`
+	maxRetries     = 3
 )
 
 var (
 	jar, _ = cookiejar.New(nil)
 	client = &http.Client{Jar: jar}
+	api    = nugs.NewClient(client)
 )
 
-var regexStrings = [11]string{
-	`^https://play.nugs.net/release/(\d+)$`,
-	`^https://play.nugs.net/#/playlists/playlist/(\d+)$`,
-	`^https://play.nugs.net/library/playlist/(\d+)$`,
-	`(^https://2nu.gs/[a-zA-Z\d]+$)`,
-	`^https://play.nugs.net/#/videos/artist/\d+/.+/(\d+)$`,
-	`^https://play.nugs.net/artist/(\d+)(?:/albums|/latest|)$`,
-	`^https://play.nugs.net/livestream/(\d+)/exclusive$`,
-	`^https://play.nugs.net/watch/livestreams/exclusive/(\d+)$`,
-	`^https://play.nugs.net/#/my-webcasts/\d+-(\d+)-\d+-\d+$`,
-	`^https://www.nugs.net/on/demandware.store/Sites-NugsNet-Site/d`+
-		`efault/(?:Stash-QueueVideo|NugsVideo-GetStashVideo)\?([a-zA-Z0-9=%&-]+$)`,
-	`^https://play.nugs.net/library/webcast/(\d+)$`,
+var eventLayouts = []string{
+	layout,
+	"1/2/2006 3:04:05 PM",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
 }
 
+// Specifier prefixes, e.g. release:23329.
+var specifierKinds = map[string]MediaKind{
+	"release":    KindRelease,
+	"playlist":   KindUserPlaylist,
+	"video":      KindVideo,
+	"artist":     KindArtist,
+	"livestream": KindLivestream,
+	"webcast":    KindWebcast,
+}
+
+// Matched against the path, or the fragment for the old hash routed player URLs.
+var playerRoutes = []*PlayerRoute{
+	{regexp.MustCompile(`^/release/(\d+)$`), KindRelease},
+	{regexp.MustCompile(`^/(?:playlists|library)/playlist/(\d+)$`), KindUserPlaylist},
+	{regexp.MustCompile(`^/videos/artist/\d+/.+/(\d+)$`), KindVideo},
+	{regexp.MustCompile(`^/artist/(\d+)(?:/albums|/latest)?$`), KindArtist},
+	{regexp.MustCompile(`^/livestream/(\d+)/exclusive$`), KindLivestream},
+	{regexp.MustCompile(`^/watch/livestreams/exclusive/(\d+)$`), KindLivestream},
+	{regexp.MustCompile(`^/my-webcasts/\d+-(\d+)-\d+-\d+$`), KindWebcast},
+	{regexp.MustCompile(`^/library/webcast/(\d+)$`), KindVideo},
+	{regexp.MustCompile(`^/watch/(?:[\w-]+/)*(\d+)$`), KindVideo},
+}
+
+var stashRegex = regexp.MustCompile(
+	`^/on/demandware\.store/Sites-NugsNet-Site/default/(?:Stash-QueueVideo|NugsVideo-GetStashVideo)$`)
+
+// Hosts that are followed to the link they redirect to.
+var shortLinkHosts = []string{"2nu.gs"}
+
 var qualityMap = map[string]Quality{
 	".alac16/": {Specs: "16-bit / 44.1 kHz ALAC", Extension: ".m4a", Format: 1},
 	".flac16/": {Specs: "16-bit / 44.1 kHz FLAC", Extension: ".flac", Format: 2},
@@ -81,6 +112,44 @@ var qualityMap = map[string]Quality{
 	".m3u8?":	{Extension: ".m4a", Format: 6},
 }
 
+// Rough averages in Kbps, only used to estimate sizes.
+var estBitrates = map[int]int{
+	1: 900,
+	2: 850,
+	3: 1600,
+	4: 1500,
+	5: 150,
+}
+
+var perfDateLayouts = []string{
+	"1/2/2006",
+	"01/02/2006",
+	"2006/01/02",
+	"2006-01-02",
+	"1/2/2006 3:04:05 PM",
+}
+
+// Higher's better. 360 Reality Audio isn't comparable so it's left out.
+var qualityRank = map[int]int{
+	1: 2,
+	2: 2,
+	3: 3,
+	5: 1,
+	6: 1,
+}
+
+var manifestExts = []string{".md5", ".sha256", ".ffp"}
+
+var trackExts = []string{".flac", ".m4a", ".mp4"}
+
+var exportCols = []string{
+	"containerID", "artistName", "containerInfo", "containerType", "performanceDate",
+	"venueName", "venueCity", "venueState", "containerRunningTime", "notes",
+	"trackID", "songID", "discNum", "setNum", "trackNum", "songTitle", "runningTime",
+}
+
+var chapterFormats = []string{"ffmeta", "mkvxml", "cue", "vtt"}
+
 var resolveRes = map[int]string{
 	1: "480",
 	2: "720",
@@ -96,12 +165,6 @@ var trackFallback = map[int]int{
 	4: 3,
 }
 
-var resFallback = map[string]string{
-	"720":  "480",
-	"1080": "720",
-	"1440": "1080",
-}
-
 func (wc *WriteCounter) Write(p []byte) (int, error) {
 	var speed int64 = 0
 	n := len(p)
@@ -246,12 +309,138 @@ func parseCfg() (*Config, error) {
 		fmt.Println("Failed to process URLs.")
 		return nil, err
 	}
+	cfg.VerifyPath = args.VerifyPath
+	cfg.Scan = args.Scan
+	cfg.Upgrade = args.Upgrade
+	cfg.Sync = args.Sync
+	cfg.Watch = args.Watch
+	cfg.Filter, err = parseFilter(args)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Search = args.Search
+	cfg.SearchType = strings.ToLower(args.SearchType)
+	if !contains([]string{"all", "artists", "shows", "songs"}, cfg.SearchType) {
+		return nil, errors.New("search type must be all, artists, shows or songs")
+	}
+	cfg.Queue = args.Queue
+	cfg.MirrorPlists = args.MirrorPlists
+	cfg.SaveMeta = args.SaveMeta
+	cfg.Notes = args.Notes
+	cfg.Artwork = strings.ToLower(args.Artwork)
+	if cfg.Artwork != "" && cfg.Artwork != "all" {
+		return nil, errors.New("artwork must be all")
+	}
+	cfg.ExportPath = args.ExportPath
+	cfg.ExportFormat = strings.ToLower(args.ExportFormat)
+	if cfg.ExportFormat == "" {
+		if strings.EqualFold(filepath.Ext(cfg.ExportPath), ".csv") {
+			cfg.ExportFormat = "csv"
+		} else {
+			cfg.ExportFormat = "jsonl"
+		}
+	}
+	if cfg.ExportFormat != "jsonl" && cfg.ExportFormat != "csv" {
+		return nil, errors.New("export format must be jsonl or csv")
+	}
+	for _, kind := range args.Library {
+		kind = strings.ToLower(kind)
+		if !contains([]string{"playlists", "favorites", "stash"}, kind) {
+			return nil, errors.New("library must be playlists, favorites or stash")
+		}
+		cfg.Library = append(cfg.Library, kind)
+	}
+	if args.PollInterval != 0 {
+		cfg.PollInterval = args.PollInterval
+	}
+	if cfg.PollInterval < 1 {
+		cfg.PollInterval = 60
+	}
+	if cfg.WatchLogPath == "" {
+		cfg.WatchLogPath = "watch.log"
+	}
+	if cfg.SyncStatePath == "" {
+		cfg.SyncStatePath = "sync_state.json"
+	}
+	cfg.RemoveOld = args.RemoveOld
+	cfg.ScanSeed = args.ScanSeed
+	if args.ArchivePath != "" {
+		cfg.ArchivePath = args.ArchivePath
+	}
+	if cfg.ScanSeed && cfg.ArchivePath == "" {
+		return nil, errors.New("seeding the archive needs an archive path")
+	}
+	if cfg.ArchivePath != "" {
+		cfg.Archive, err = loadArchive(cfg.ArchivePath)
+		if err != nil {
+			fmt.Println("Failed to load archive.")
+			return nil, err
+		}
+	}
 	cfg.ForceVideo = args.ForceVideo
 	cfg.SkipVideos = args.SkipVideos
 	cfg.SkipChapters = args.SkipChapters
+	cfg.Schedule = args.Schedule
+	if args.VariantNum < 0 {
+		return nil, errors.New("video variant number can't be negative")
+	}
+	cfg.VariantNum = args.VariantNum
+	cfg.MaxBitrate = args.MaxBitrate
+	cfg.ListFormats = args.ListFormats
+	cfg.VideoAudio = args.VideoAudio
+	for _, format := range args.ChapterFormats {
+		if !contains(chapterFormats, format) {
+			return nil, errors.New("chapter formats must be ffmeta, mkvxml, cue or vtt")
+		}
+	}
+	cfg.ChapterFormats = args.ChapterFormats
+	if args.Nfo != "" && args.Nfo != "musicvideo" && args.Nfo != "movie" {
+		return nil, errors.New("nfo type must be musicvideo or movie")
+	}
+	cfg.Nfo = args.Nfo
+	cfg.AlbumM3u = args.AlbumM3u
+	cfg.Cue = args.Cue
+	cfg.Checksums = args.Checksums
+	cfg.CheckIntegrity = args.CheckIntegrity
+	if args.ScheduleRetry < 1 {
+		return nil, errors.New("schedule retry delay must be at least 1 second")
+	}
+	cfg.ScheduleRetry = args.ScheduleRetry
+	err = checkMode(cfg)
+	if err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
 
+// Checks the URLs against the mode, in the order main dispatches them.
+func checkMode(cfg *Config) error {
+	urlTotal := len(cfg.Urls)
+	switch {
+	case cfg.VerifyPath != "":
+		if urlTotal > 0 {
+			return errors.New("--verify doesn't take urls")
+		}
+	case cfg.ExportPath != "":
+		if urlTotal == 0 {
+			return errors.New("--export needs at least one url")
+		}
+	case cfg.Watch:
+		if urlTotal > 0 {
+			return errors.New("--watch doesn't take urls, it uses the config's followed artists")
+		}
+	case cfg.Scan:
+		if urlTotal > 0 {
+			return errors.New("--scan doesn't take urls")
+		}
+	case cfg.Search != "", len(cfg.Library) > 0, cfg.MirrorPlists:
+		// These add to any urls given.
+	case urlTotal == 0:
+		return errors.New("at least one url is required")
+	}
+	return nil
+}
+
 func readConfig() (*Config, error) {
 	data, err := ioutil.ReadFile("config.json")
 	if err != nil {
@@ -291,82 +480,7 @@ func sanitise(filename string) string {
 	return strings.TrimSuffix(san, "\t")
 }
 
-func auth(email, pwd string) (string, error) {
-	data := url.Values{}
-	data.Set("client_id", clientId)
-	data.Set("grant_type", "password")
-	data.Set("scope", "openid profile email nugsnet:api nugsnet:legacyapi offline_access")
-	data.Set("username", email)
-	data.Set("password", pwd)
-	req, err := http.NewRequest(http.MethodPost, authUrl, strings.NewReader(data.Encode()))
-	if err != nil {
-		return "", err
-	}
-	req.Header.Add("User-Agent", userAgent)
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	do, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer do.Body.Close()
-	if do.StatusCode != http.StatusOK {
-		return "", errors.New(do.Status)
-	}
-	var obj Auth
-	err = json.NewDecoder(do.Body).Decode(&obj)
-	if err != nil {
-		return "", err
-	}
-	return obj.AccessToken, nil
-}
-
-func getUserInfo(token string) (string, error) {
-	req, err := http.NewRequest(http.MethodGet, userInfoUrl, nil)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Add("Authorization", "Bearer "+token)
-	req.Header.Add("User-Agent", userAgent)
-	do, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer do.Body.Close()
-	if do.StatusCode != http.StatusOK {
-		return "", errors.New(do.Status)
-	}
-	var obj UserInfo
-	err = json.NewDecoder(do.Body).Decode(&obj)
-	if err != nil {
-		return "", err
-	}
-	return obj.Sub, nil
-}
-
-func getSubInfo(token string) (*SubInfo, error) {
-	req, err := http.NewRequest(http.MethodGet, subInfoUrl, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Add("Authorization", "Bearer "+token)
-	req.Header.Add("User-Agent", userAgent)
-	do, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer do.Body.Close()
-	if do.StatusCode != http.StatusOK {
-		return nil, errors.New(do.Status)
-	}
-	var obj SubInfo
-	err = json.NewDecoder(do.Body).Decode(&obj)
-	if err != nil {
-		return nil, err
-	}
-	return &obj, nil
-}
-
-func getPlan(subInfo *SubInfo) (string, bool) {
+func getPlan(subInfo *nugs.SubInfo) (string, bool) {
 	if !reflect.ValueOf(subInfo.Plan).IsZero() {
 		return subInfo.Plan.Description, false
 	} else {
@@ -382,9 +496,9 @@ func parseTimestamps(start, end string) (string, string) {
 	return parsedStart, parsedEnd
 }
 
-func parseStreamParams(userId string, subInfo *SubInfo, isPromo bool) *StreamParams {
+func parseStreamParams(userId string, subInfo *nugs.SubInfo, isPromo bool) *nugs.StreamParams {
 	startStamp, endStamp := parseTimestamps(subInfo.StartedAt, subInfo.EndsAt)
-	streamParams := &StreamParams{
+	streamParams := &nugs.StreamParams{
 		SubscriptionID:          subInfo.LegacySubscriptionID,
 		SubCostplanIDAccessList: subInfo.Plan.PlanID,
 		UserID:                  userId,
@@ -399,204 +513,135 @@ func parseStreamParams(userId string, subInfo *SubInfo, isPromo bool) *StreamPar
 	return streamParams
 }
 
-func checkUrl(_url string) (string, int) {
-	for i, regexStr := range regexStrings {
-		regex := regexp.MustCompile(regexStr)
-		match := regex.FindStringSubmatch(_url)
-		if match != nil {
-			return match[1], i
-		}
+// e.g. release:23329 or webcast:5826189-30369-0-624602.
+func parseSpecifier(spec string) (*MediaRef, bool) {
+	split := strings.SplitN(spec, ":", 2)
+	if len(split) != 2 {
+		return nil, false
 	}
-	return "", 0
-}
-
-func extractLegToken(tokenStr string) (string, string, error) {
-	payload := strings.SplitN(tokenStr, ".", 3)[1]
-	decoded, err := base64.RawURLEncoding.DecodeString(payload)
-	if err != nil {
-		return "", "", err
+	kind, ok := specifierKinds[strings.ToLower(split[0])]
+	if !ok {
+		return nil, false
+	}
+	itemId := strings.TrimSpace(split[1])
+	if kind == KindWebcast && strings.Contains(itemId, "-") {
+		// Same ID the my-webcasts route captures.
+		itemId = strings.Split(itemId, "-")[1]
 	}
-	var obj Payload
-	err = json.Unmarshal(decoded, &obj)
+	_, err := strconv.Atoi(itemId)
 	if err != nil {
-		return "", "", err
+		return nil, false
 	}
-	return obj.LegacyToken, obj.LegacyUguid, nil
+	return &MediaRef{Kind: kind, ID: itemId}, true
 }
 
-func getAlbumMeta(albumId string) (*AlbumMeta, error) {
-	req, err := http.NewRequest(http.MethodGet, streamApiBase+"api.aspx", nil)
-	if err != nil {
-		return nil, err
-	}
-	query := url.Values{}
-	query.Set("method", "catalog.container")
-	query.Set("containerID", albumId)
-	query.Set("vdisp", "1")
-	req.URL.RawQuery = query.Encode()
-	req.Header.Add("User-Agent", userAgent)
-	do, err := client.Do(req)
-	if err != nil {
-		return nil, err
+func normaliseHost(host string) string {
+	host = strings.ToLower(host)
+	host = strings.TrimPrefix(host, "www.")
+	return strings.TrimPrefix(host, "m.")
+}
+
+func getPlGUID(u *url.URL) string {
+	plGUID := u.Query().Get("plGUID")
+	if plGUID != "" {
+		return plGUID
 	}
-	defer do.Body.Close()
-	if do.StatusCode != http.StatusOK {
-		return nil, errors.New(do.Status)
+	// Hash routed, e.g. #/playlists/catalog?plGUID=...
+	_, fragQuery, ok := strings.Cut(u.Fragment, "?")
+	if !ok {
+		return ""
 	}
-	var obj AlbumMeta
-	err = json.NewDecoder(do.Body).Decode(&obj)
+	q, err := url.ParseQuery(fragQuery)
 	if err != nil {
-		return nil, err
+		return ""
 	}
-	return &obj, nil
+	return q.Get("plGUID")
 }
 
-func getPlistMeta(plistId, email, legacyToken string, cat bool) (*PlistMeta, error) {
-	var path string
-	if cat {
-		path = "api.aspx"
-	} else {
-		path = "secureApi.aspx"
-	}
-	req, err := http.NewRequest(http.MethodGet, streamApiBase+path, nil)
+// Like client.Get, but cancelled with ctx.
+func httpGet(ctx context.Context, _url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, _url, nil)
 	if err != nil {
 		return nil, err
 	}
-	query := url.Values{}
-	if cat {
-		query.Set("method", "catalog.playlist")
-		query.Set("plGUID", plistId)
-	} else {
-		query.Set("method", "user.playlist")
-		query.Set("playlistID", plistId)
-		query.Set("developerKey", devKey)
-		query.Set("user", email)
-		query.Set("token", legacyToken)
-	}
-	req.URL.RawQuery = query.Encode()
-	req.Header.Add("User-Agent", userAgentTwo)
-	do, err := client.Do(req)
+	return client.Do(req)
+}
+
+// Follows any redirects and returns where they end up.
+func resolveShortLink(ctx context.Context, shortUrl string) (string, error) {
+	resp, err := httpGet(ctx, shortUrl)
 	if err != nil {
-		return nil, err
-	}
-	defer do.Body.Close()
-	if do.StatusCode != http.StatusOK {
-		return nil, errors.New(do.Status)
+		return "", err
 	}
-	var obj PlistMeta
-	err = json.NewDecoder(do.Body).Decode(&obj)
-	if err != nil {
-		return nil, err
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New(resp.Status)
 	}
-	return &obj, nil
+	return resp.Request.URL.String(), nil
 }
 
-func getArtistMeta(artistId string) ([]*ArtistMeta, error) {
-	var allArtistMeta []*ArtistMeta
-	offset := 1
-	query := url.Values{}
-	query.Set("method", "catalog.containersAll")
-	query.Set("limit", "100")
-	query.Set("artistList", artistId)
-	query.Set("availType", "1")
-	query.Set("vdisp", "1")
-	for {
-		req, err := http.NewRequest(http.MethodGet, streamApiBase+"api.aspx", nil)
-		if err != nil {
-			return nil, err
-		}
-		query.Set("startOffset", strconv.Itoa(offset))
-		req.URL.RawQuery = query.Encode()
-		req.Header.Add("User-Agent", userAgent)
-		do, err := client.Do(req)
-		if err != nil {
-			return nil, err
-		}
-		if do.StatusCode != http.StatusOK {
-			do.Body.Close()
-			return nil, errors.New(do.Status)
-		}
-		var obj ArtistMeta
-		err = json.NewDecoder(do.Body).Decode(&obj)
-		do.Body.Close()
-		if err != nil {
-			return nil, err
-		}
-		retLen := len(obj.Response.Containers)
-		if retLen == 0 {
-			break
+func isNugsHost(host string) bool {
+	return host == "nugs.net" || strings.HasSuffix(host, ".nugs.net") || contains(shortLinkHosts, host)
+}
+
+func parsePlayerRoute(route string) *MediaRef {
+	route = "/" + strings.Trim(route, "/")
+	for _, playerRoute := range playerRoutes {
+		match := playerRoute.Regex.FindStringSubmatch(route)
+		if match != nil {
+			return &MediaRef{Kind: playerRoute.Kind, ID: match[1]}
 		}
-		allArtistMeta = append(allArtistMeta, &obj)
-		offset += retLen
 	}
-	return allArtistMeta, nil
+	return nil
 }
 
-func getPurchasedManUrl(skuID int, showID, userID, uguID string) (string, error) {
-	req, err := http.NewRequest(http.MethodGet, streamApiBase+"bigriver/vidPlayer.aspx", nil)
-	if err != nil {
-		return "", err
-	}
-	query := url.Values{}
-	query.Set("skuId", strconv.Itoa(skuID))
-	query.Set("showId", showID)
-	query.Set("uguid", uguID)
-	query.Set("nn_userID", userID)
-	query.Set("app", "1")
-	req.URL.RawQuery = query.Encode()
-	req.Header.Add("User-Agent", userAgentTwo)
-	do, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer do.Body.Close()
-	if do.StatusCode != http.StatusOK {
-		return "", errors.New(do.Status)
+func parseUrl(ctx context.Context, rawUrl string, followLinks bool) (*MediaRef, error) {
+	ref, ok := parseSpecifier(rawUrl)
+	if ok {
+		return ref, nil
 	}
-	var obj PurchasedManResp
-	err = json.NewDecoder(do.Body).Decode(&obj)
-	if err != nil {
-		return "", err
+	if !strings.Contains(rawUrl, "://") {
+		rawUrl = "https://" + rawUrl
 	}
-	return obj.FileURL, nil
-}
-
-func getStreamMeta(trackId, skuId, format int, streamParams *StreamParams) (string, error) {
-	req, err := http.NewRequest(http.MethodGet, streamApiBase+"bigriver/subPlayer.aspx", nil)
+	u, err := url.Parse(rawUrl)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	query := url.Values{}
-	if format == 0 {
-		query.Set("skuId", strconv.Itoa(skuId))
-		query.Set("containerID", strconv.Itoa(trackId))
-		query.Set("chap", "1")
-	} else {
-		query.Set("platformID", strconv.Itoa(format))
-		query.Set("trackID", strconv.Itoa(trackId))
-	}
-	query.Set("app", "1")
-	query.Set("subscriptionID", streamParams.SubscriptionID)
-	query.Set("subCostplanIDAccessList", streamParams.SubCostplanIDAccessList)
-	query.Set("nn_userID", streamParams.UserID)
-	query.Set("startDateStamp", streamParams.StartStamp)
-	query.Set("endDateStamp", streamParams.EndStamp)
-	req.URL.RawQuery = query.Encode()
-	req.Header.Add("User-Agent", userAgentTwo)
-	do, err := client.Do(req)
-	if err != nil {
-		return "", err
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("unsupported scheme: " + u.Scheme)
+	}
+	host := normaliseHost(u.Host)
+	plGUID := getPlGUID(u)
+	switch {
+	case plGUID != "" && isNugsHost(host):
+		return &MediaRef{Kind: KindCatPlaylist, ID: plGUID}, nil
+	case host == "nugs.net":
+		if stashRegex.MatchString(u.Path) {
+			if u.Query().Get("showID") == "" {
+				return nil, errors.New("purchased livestream url has no show id")
+			}
+			return &MediaRef{Kind: KindPaidLivestream, ID: u.RawQuery}, nil
+		}
+	case host == "play.nugs.net":
+		route := u.Path
+		if strings.HasPrefix(u.Fragment, "/") {
+			route, _, _ = strings.Cut(u.Fragment, "?")
+		}
+		ref = parsePlayerRoute(route)
+		if ref != nil {
+			return ref, nil
+		}
+		return nil, errors.New("unsupported player link")
 	}
-	defer do.Body.Close()
-	if do.StatusCode != http.StatusOK {
-		return "", errors.New(do.Status)
+	if !followLinks || !contains(shortLinkHosts, host) {
+		return nil, errors.New("unsupported link")
 	}
-	var obj StreamMeta
-	err = json.NewDecoder(do.Body).Decode(&obj)
+	resolved, err := resolveShortLink(ctx, u.String())
 	if err != nil {
-		return "", err
+		fmt.Println("Failed to follow short link.")
+		return nil, err
 	}
-	return obj.StreamLink, nil
+	return parseUrl(ctx, resolved, false)
 }
 
 func queryQuality(streamUrl string) *Quality {
@@ -609,18 +654,26 @@ func queryQuality(streamUrl string) *Quality {
 	return nil
 }
 
-func downloadTrack(trackPath, _url string) error {
-	f, err := os.OpenFile(trackPath, os.O_CREATE|os.O_WRONLY, 0755)
+// A short body with a wrong Content-Length doesn't make io.Copy fail.
+func checkWritten(written, expected int64) error {
+	if expected > 0 && written != expected {
+		return fmt.Errorf("incomplete download, got %d of %d bytes", written, expected)
+	}
+	return nil
+}
+
+func downloadTrack(ctx context.Context, trackPath, _url string) error {
+	f, err := os.OpenFile(trackPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	req, err := http.NewRequest(http.MethodGet, _url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, _url, nil)
 	if err != nil {
 		return err
 	}
 	req.Header.Add("Referer", playerUrl)
-	req.Header.Add("User-Agent", userAgent)
+	req.Header.Add("User-Agent", nugs.UserAgent)
 	req.Header.Add("Range", "bytes=0-")
 	do, err := client.Do(req)
 	if err != nil {
@@ -636,9 +689,158 @@ func downloadTrack(trackPath, _url string) error {
 		TotalStr:  humanize.Bytes(uint64(totalBytes)),
 		StartTime: time.Now().UnixMilli(),
 	}
-	_, err = io.Copy(f, io.TeeReader(do.Body, counter))
+	written, err := io.Copy(f, io.TeeReader(do.Body, counter))
 	fmt.Println("")
-	return err
+	if err != nil {
+		return err
+	}
+	return checkWritten(written, totalBytes)
+}
+
+func getPcmFormat(bitsPerSample int) (string, error) {
+	switch bitsPerSample {
+	case 8:
+		return "s8", nil
+	case 16:
+		return "s16le", nil
+	case 24:
+		return "s24le", nil
+	case 32:
+		return "s32le", nil
+	}
+	return "", fmt.Errorf("unsupported bit depth: %d", bitsPerSample)
+}
+
+// Decodes every frame and compares the MD5 of the PCM with STREAMINFO's.
+func checkFlac(ctx context.Context, flacPath, ffmpegNameStr string) error {
+	var errBuffer bytes.Buffer
+	streamInfo, err := readFlacStreamInfo(flacPath)
+	if err != nil {
+		return err
+	}
+	pcmFormat, err := getPcmFormat(streamInfo.BitsPerSample)
+	if err != nil {
+		return err
+	}
+	args := []string{
+		"-hide_banner", "-v", "error", "-xerror", "-i", flacPath,
+		"-f", pcmFormat, "-c:a", "pcm_" + pcmFormat, "pipe:",
+	}
+	md5Hash := md5.New()
+	cmd := exec.CommandContext(ctx, ffmpegNameStr, args...)
+	cmd.Stdout = md5Hash
+	cmd.Stderr = &errBuffer
+	err = cmd.Run()
+	if err != nil {
+		errString := fmt.Sprintf("%s\n%s", err, errBuffer.String())
+		return errors.New(errString)
+	}
+	if errBuffer.Len() > 0 {
+		return errors.New("flac decode errors: " + strings.TrimSpace(errBuffer.String()))
+	}
+	if isUnsetMd5(streamInfo.MD5) {
+		return nil
+	}
+	if hex.EncodeToString(md5Hash.Sum(nil)) != streamInfo.MD5 {
+		return errors.New("flac audio md5 mismatch")
+	}
+	return nil
+}
+
+// Returns the box's type, total size and header size.
+func readBoxHeader(f *os.File, offset, end int64) (string, int64, int64, error) {
+	header := make([]byte, 16)
+	if end-offset < 8 {
+		return "", 0, 0, fmt.Errorf("truncated box header at offset %d", offset)
+	}
+	_, err := f.ReadAt(header[:8], offset)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	size := int64(binary.BigEndian.Uint32(header[:4]))
+	boxType := string(header[4:8])
+	headerSize := int64(8)
+	switch size {
+	case 0:
+		size = end - offset
+	case 1:
+		_, err = f.ReadAt(header[8:16], offset+8)
+		if err != nil {
+			return "", 0, 0, err
+		}
+		size = int64(binary.BigEndian.Uint64(header[8:16]))
+		headerSize = 16
+	}
+	if size < headerSize || offset+size > end {
+		return "", 0, 0, fmt.Errorf("bad size for %s box at offset %d", boxType, offset)
+	}
+	return boxType, size, headerSize, nil
+}
+
+func walkMp4Boxes(f *os.File, start, end int64) ([]string, error) {
+	var boxTypes []string
+	offset := start
+	for offset < end {
+		boxType, size, _, err := readBoxHeader(f, offset, end)
+		if err != nil {
+			return nil, err
+		}
+		boxTypes = append(boxTypes, boxType)
+		offset += size
+	}
+	return boxTypes, nil
+}
+
+// Returns the start and end of the first wantType box's body, or 0, 0 if there isn't one.
+func findMp4Box(f *os.File, start, end int64, wantType string) (int64, int64, error) {
+	offset := start
+	for offset < end {
+		boxType, size, headerSize, err := readBoxHeader(f, offset, end)
+		if err != nil {
+			return 0, 0, err
+		}
+		if boxType == wantType {
+			return offset + headerSize, offset + size, nil
+		}
+		offset += size
+	}
+	return 0, 0, nil
+}
+
+// Only checks the structure, the sample data itself isn't decoded.
+func checkMp4(mp4Path string) error {
+	f, err := os.Open(mp4Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	boxTypes, err := walkMp4Boxes(f, 0, stat.Size())
+	if err != nil {
+		return err
+	}
+	if len(boxTypes) == 0 || boxTypes[0] != "ftyp" {
+		return errors.New("mp4 doesn't start with an ftyp box")
+	}
+	for _, required := range []string{"moov", "mdat"} {
+		if !contains(boxTypes, required) {
+			return errors.New("mp4 has no " + required + " box")
+		}
+	}
+	return nil
+}
+
+func checkIntegrity(ctx context.Context, filePath, ffmpegNameStr string) error {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".flac":
+		return checkFlac(ctx, filePath, ffmpegNameStr)
+	case ".m4a", ".mp4":
+		return checkMp4(filePath)
+	}
+	return nil
 }
 
 func getTrackQual(quals []*Quality, wantFmt int) *Quality {
@@ -659,8 +861,8 @@ func extractBitrate(manUrl string) string {
 	return ""
 }
 
-func parseHlsMaster(qual *Quality) error {
-	req, err := client.Get(qual.URL)
+func parseHlsMaster(ctx context.Context, qual *Quality) error {
+	req, err := httpGet(ctx, qual.URL)
 	if err != nil {
 		return err
 	}
@@ -690,8 +892,8 @@ func parseHlsMaster(qual *Quality) error {
 	qual.URL = manBase + variantUri + q
 	return nil
 }
-func getKey(keyUrl string) ([]byte, error) {
-	req, err := client.Get(keyUrl)
+func getKey(ctx context.Context, keyUrl string) ([]byte, error) {
+	req, err := httpGet(ctx, keyUrl)
 	if err != nil {
 		return nil, err
 	}
@@ -762,9 +964,9 @@ func decryptTrack(key, iv []byte) ([]byte, error) {
 	return decrypted, nil
 }
 
-func tsToAac(decData []byte, outPath, ffmpegNameStr string) error {
+func tsToAac(ctx context.Context, decData []byte, outPath, ffmpegNameStr string) error {
 	var errBuffer bytes.Buffer
-	cmd := exec.Command(ffmpegNameStr, "-i", "pipe:", "-c:a", "copy", outPath)
+	cmd := exec.CommandContext(ctx, ffmpegNameStr, "-i", "pipe:", "-c:a", "copy", outPath)
 	cmd.Stdin = bytes.NewReader(decData)
 	cmd.Stderr = &errBuffer
 	err := cmd.Run()
@@ -776,8 +978,8 @@ func tsToAac(decData []byte, outPath, ffmpegNameStr string) error {
 }
 
 
-func hlsOnly(trackPath, manUrl, ffmpegNameStr string) error {
-	req, err := client.Get(manUrl)
+func hlsOnly(ctx context.Context, trackPath, manUrl, ffmpegNameStr string) error {
+	req, err := httpGet(ctx, manUrl)
 	if err != nil {
 		return err
 	}
@@ -798,7 +1000,7 @@ func hlsOnly(trackPath, manUrl, ffmpegNameStr string) error {
 	tsUrl := manBase + media.Segments[0].URI + q
 
 	key := media.Key
-	keyBytes, err := getKey(manBase + key.URI)
+	keyBytes, err := getKey(ctx, manBase + key.URI)
 	if err != nil {
 		return err
 	}
@@ -808,7 +1010,7 @@ func hlsOnly(trackPath, manUrl, ffmpegNameStr string) error {
 		return err
 	}
 
-	err = downloadTrack("temp_enc.ts", tsUrl)
+	err = downloadTrack(ctx, "temp_enc.ts", tsUrl)
 	if err != nil {
 		return err
 	}
@@ -820,7 +1022,7 @@ func hlsOnly(trackPath, manUrl, ffmpegNameStr string) error {
 	if err != nil {
 		return err
 	}
-	err = tsToAac(decData, trackPath, ffmpegNameStr)
+	err = tsToAac(ctx, decData, trackPath, ffmpegNameStr)
 	return err
 }
 
@@ -833,22 +1035,17 @@ func checkIfHlsOnly(quals []*Quality) bool {
 	return true
 }
 
-func processTrack(folPath string, trackNum, trackTotal int, cfg *Config, track *Track, streamParams *StreamParams) error {
-	origWantFmt := cfg.Format
-	wantFmt := origWantFmt
-	var (
-		quals      []*Quality
-		chosenQual *Quality
-	)
+func getTrackQuals(ctx context.Context, trackID int, streamParams *nugs.StreamParams) ([]*Quality, error) {
+	var quals []*Quality
 	// Call the stream meta endpoint four times to get all avail formats since the formats can shift.
 	// This will ensure the right format's always chosen.
 	for _, i := range [4]int{1, 4, 7, 10} {
-		streamUrl, err := getStreamMeta(track.TrackID, 0, i, streamParams)
+		streamUrl, err := api.GetStreamMeta(ctx, trackID, 0, i, streamParams)
 		if err != nil {
 			fmt.Println("failed to get track stream metadata")
-			return err
+			return nil, err
 		} else if streamUrl == "" {
-			return errors.New("the api didn't return a track stream URL")
+			return nil, errors.New("the api didn't return a track stream URL")
 		}
 		quality := queryQuality(streamUrl)
 		if quality == nil {
@@ -864,7 +1061,30 @@ func processTrack(folPath string, trackNum, trackTotal int, cfg *Config, track *
 	}
 
 	if len(quals) == 0 {
-		return errors.New("the api didn't return any formats")
+		return nil, errors.New("the api didn't return any formats")
+	}
+	return quals, nil
+}
+
+// Returned by processTrack for tracks --upgrade has nothing stored for.
+var errNotStored = errors.New("track isn't stored locally")
+
+// Decides whether --upgrade downloads a track given its stored copy, if any.
+func checkUpgrade(oldPath string, oldFormat, newFormat int) (bool, error) {
+	if oldPath == "" {
+		return false, errNotStored
+	}
+	return qualityRank[newFormat] > qualityRank[oldFormat], nil
+}
+
+// comment is written to the COMMENT and DESCRIPTION tags of new downloads if not empty.
+func processTrack(ctx context.Context, folPath string, trackNum, trackTotal, containerID int, cfg *Config, track *nugs.Track, streamParams *nugs.StreamParams, comment string) (string, error) {
+	origWantFmt := cfg.Format
+	wantFmt := origWantFmt
+	var chosenQual *Quality
+	quals, err := getTrackQuals(ctx, track.TrackID, streamParams)
+	if err != nil {
+		return "", err
 	}
 
 	isHlsOnly := checkIfHlsOnly(quals)
@@ -872,9 +1092,9 @@ func processTrack(folPath string, trackNum, trackTotal int, cfg *Config, track *
 	if isHlsOnly {
 		fmt.Println("HLS-only track. Only AAC is available, tags currently unsupported.")
 		chosenQual = quals[0]
-		err := parseHlsMaster(chosenQual)
+		err = parseHlsMaster(ctx, chosenQual)
 		if err != nil {
-			return err
+			return "", err
 		}
 	} else {
 		for {
@@ -887,7 +1107,7 @@ func processTrack(folPath string, trackNum, trackTotal int, cfg *Config, track *
 			}
 		}
 		if chosenQual == nil {
-			return errors.New("no track format was chosen")
+			return "", errors.New("no track format was chosen")
 		}
 		if wantFmt != origWantFmt && origWantFmt != 4 {
 			fmt.Println("Unavailable in your chosen format.")
@@ -897,707 +1117,3573 @@ func processTrack(folPath string, trackNum, trackTotal int, cfg *Config, track *
 		"%02d. %s%s", trackNum, sanitise(track.SongTitle), chosenQual.Extension,
 	)
 	trackPath := filepath.Join(folPath, trackFname)
+	dlPath := trackPath
+	var oldPath string
+	if cfg.Upgrade {
+		var oldFormat int
+		oldPath, oldFormat, err = getStoredTrack(folPath, trackNum, track, cfg)
+		if err != nil {
+			fmt.Println("Failed to check for stored track.")
+			return "", err
+		}
+		upgrade, err := checkUpgrade(oldPath, oldFormat, chosenQual.Format)
+		if err != nil {
+			return "", err
+		}
+		if !upgrade {
+			fmt.Println("Track already exists locally in the same or better quality.")
+			return oldPath, nil
+		}
+		fmt.Println("Upgrading track to " + chosenQual.Specs + ".")
+		// Don't clobber the old file until the new one's good.
+		if oldPath == trackPath {
+			dlPath = filepath.Join(folPath, upgradeTmpName+chosenQual.Extension)
+		}
+	}
 	exists, err := fileExists(trackPath)
 	if err != nil {
 		fmt.Println("Failed to check if track already exists locally.")
-		return err
+		return "", err
 	}
-	if exists {
+	if exists && oldPath == "" {
 		fmt.Println("Track already exists locally.")
-		return nil
+		return trackPath, nil
 	}
 	fmt.Printf(
 		"Downloading track %d of %d: %s - %s\n", trackNum, trackTotal, track.SongTitle,
 		chosenQual.Specs,
 	)
-	if isHlsOnly {
-		err = hlsOnly(trackPath, chosenQual.URL, cfg.FfmpegNameStr)
-	} else {
-		err = downloadTrack(trackPath, chosenQual.URL)
-	}
-	if err != nil {
-		fmt.Println("Failed to download track.")
-		return err
+	for attempt := 1; ; attempt++ {
+		if isHlsOnly {
+			err = hlsOnly(ctx, dlPath, chosenQual.URL, cfg.FfmpegNameStr)
+		} else {
+			err = downloadTrack(ctx, dlPath, chosenQual.URL)
+		}
+		if err == nil && cfg.CheckIntegrity {
+			err = checkIntegrity(ctx, dlPath, cfg.FfmpegNameStr)
+		}
+		if err == nil {
+			break
+		}
+		removeErr := os.Remove(dlPath)
+		if removeErr != nil && !os.IsNotExist(removeErr) {
+			fmt.Println("Failed to delete bad track.")
+		}
+		if attempt == maxRetries || ctx.Err() != nil {
+			fmt.Println("Failed to download track.")
+			return "", err
+		}
+		handleErr(fmt.Sprintf("Track download failed, retrying (%d of %d).", attempt, maxRetries-1), err, false)
 	}
-	return nil
-}
-
-func album(albumID string, cfg *Config, streamParams *StreamParams, artResp *AlbArtResp) error {
-	var (
-		meta   *AlbArtResp
-		tracks []Track
-	)
-	if albumID == "" {
-		meta = artResp
-		tracks = meta.Songs
-	} else {
-		_meta, err := getAlbumMeta(albumID)
+	if comment != "" {
+		err = tagComment(ctx, dlPath, comment, cfg.FfmpegNameStr)
 		if err != nil {
-			fmt.Println("Failed to get metadata.")
-			return err
+			handleErr("Failed to tag track with notes.", err, false)
 		}
-		meta = _meta.Response
-		tracks = meta.Tracks
-	}
-
-	trackTotal := len(tracks)
-
-	skuID := getVideoSku(meta.Products)
-
-	if skuID == 0 && trackTotal < 1 {
-		return errors.New("release has no tracks or videos")
 	}
-
-	if skuID != 0 {
-		if cfg.SkipVideos {
-			fmt.Println("Video-only album, skipped.")
-			return nil
+	if dlPath != trackPath {
+		err = os.Rename(dlPath, trackPath)
+		if err != nil {
+			fmt.Println("Failed to replace old track.")
+			return "", err
 		}
-		if cfg.ForceVideo || trackTotal < 1 {
-			return video(albumID, "", cfg, streamParams, meta, false)
+	} else if oldPath != "" && cfg.RemoveOld {
+		err = os.Remove(oldPath)
+		if err != nil {
+			handleErr("Failed to delete old track.", err, false)
 		}
 	}
-	albumFolder := meta.ArtistName + " - " + strings.TrimRight(meta.ContainerInfo, " ")
-	fmt.Println(albumFolder)
-	if len(albumFolder) > 120 {
-		albumFolder = albumFolder[:120]
-		fmt.Println(
-			"Album folder name was chopped because it exceeds 120 characters.")
-	}
-	albumPath := filepath.Join(cfg.OutPath, sanitise(albumFolder))
-	err := makeDirs(albumPath)
+	err = archiveTrack(cfg, containerID, track.TrackID, chosenQual.Format, trackPath)
 	if err != nil {
-		fmt.Println("Failed to make album folder.")
-		return err
-	}
-	for trackNum, track := range tracks {
-		trackNum++
-		err := processTrack(
-			albumPath, trackNum, trackTotal, cfg, &track, streamParams)
-		if err != nil {
-			handleErr("Track failed.", err, false)
-		}
+		handleErr("Failed to update archive.", err, false)
 	}
-	return nil
+	return trackPath, nil
 }
 
-func getAlbumTotal(meta []*ArtistMeta) int {
-	var total int
-	for _, _meta := range meta {
-		total += len(_meta.Response.Containers)
+func writeRawMeta(metaPath string, raw json.RawMessage) error {
+	if len(raw) == 0 {
+		return errors.New("no raw metadata was kept")
 	}
-	return total
-}
-
-func artist(artistId string, cfg *Config, streamParams *StreamParams) error {
-	meta, err := getArtistMeta(artistId)
+	var buf bytes.Buffer
+	err := json.Indent(&buf, raw, "", "\t")
 	if err != nil {
-		fmt.Println("Failed to get artist metadata.")
 		return err
 	}
-	if len(meta) == 0 {
-		return errors.New(
-			"The API didn't return any artist metadata.")
-	}
-	fmt.Println(meta[0].Response.Containers[0].ArtistName)
-	albumTotal := getAlbumTotal(meta)
-	for _, _meta := range meta {
-		for albumNum, container := range _meta.Response.Containers {
-			fmt.Printf("Item %d of %d:\n", albumNum+1, albumTotal)
-			if cfg.SkipVideos {
-				err = album("", cfg, streamParams, container)
-			} else {
-				// Can't re-use this metadata as it doesn't have any product info for videos.
-				err = album(strconv.Itoa(container.ContainerID), cfg, streamParams, nil)
-			}
-			if err != nil {
-				handleErr("Item failed.", err, false)
-			}
+	buf.WriteString("\n")
+	return os.WriteFile(metaPath, buf.Bytes(), 0644)
+}
+
+// Paths are written relative to the M3U's folder so the library can be moved.
+func writeM3u(m3uPath string, entries []*M3uEntry) error {
+	var sb strings.Builder
+	m3uDir := filepath.Dir(m3uPath)
+	sb.WriteString("#EXTM3U\n")
+	for _, entry := range entries {
+		relPath, err := filepath.Rel(m3uDir, entry.Path)
+		if err != nil {
+			return err
+		}
+		duration := entry.Duration
+		if duration == 0 {
+			duration = -1
 		}
+		sb.WriteString(fmt.Sprintf("#EXTINF:%d,%s\n", duration, entry.Title))
+		sb.WriteString(filepath.ToSlash(relPath) + "\n")
 	}
-	return nil
+	return os.WriteFile(m3uPath, []byte(sb.String()), 0755)
 }
 
-func playlist(plistId, legacyToken string, cfg *Config, streamParams *StreamParams, cat bool) error {
-	_meta, err := getPlistMeta(plistId, cfg.Email, legacyToken, cat)
+// Skips any ID3v2 tag some taggers stick in front of the fLaC marker.
+func skipId3(f *os.File) error {
+	header := make([]byte, 10)
+	_, err := io.ReadFull(f, header)
 	if err != nil {
-		fmt.Println("Failed to get playlist metadata.")
 		return err
 	}
-	meta := _meta.Response
-	plistName := meta.PlayListName
-	fmt.Println(plistName)
-	if len(plistName) > 120 {
-		plistName = plistName[:120]
-		fmt.Println(
-			"Playlist folder name was chopped because it exceeds 120 characters.")
-	}
-	plistPath := filepath.Join(cfg.OutPath, sanitise(plistName))
-	err = makeDirs(plistPath)
-	if err != nil {
-		fmt.Println("Failed to make playlist folder.")
+	if string(header[:3]) != "ID3" {
+		_, err = f.Seek(0, io.SeekStart)
 		return err
 	}
-	trackTotal := len(meta.Items)
-	for trackNum, track := range meta.Items {
-		trackNum++
-		err := processTrack(
-			plistPath, trackNum, trackTotal, cfg, &track.Track, streamParams)
-		if err != nil {
-			handleErr("Track failed.", err, false)
-		}
-	}
-	return nil
+	size := int64(header[6])<<21 | int64(header[7])<<14 | int64(header[8])<<7 | int64(header[9])
+	_, err = f.Seek(10+size, io.SeekStart)
+	return err
 }
 
-func getVideoSku(products []Product) int {
-	for _, product := range products {
-		formatStr := product.FormatStr
-		if formatStr == "VIDEO ON DEMAND" || formatStr == "LIVE HD VIDEO" {
-			return product.SkuID
-		}
+func readFlacStreamInfo(flacPath string) (*FlacStreamInfo, error) {
+	f, err := os.Open(flacPath)
+	if err != nil {
+		return nil, err
 	}
-	return 0
-}
-
-func getLstreamSku(products []*ProductFormatList) int {
-	for _, product := range products {
-		if product.FormatStr == "LIVE HD VIDEO" {
-			return product.SkuID
-		}
+	defer f.Close()
+	err = skipId3(f)
+	if err != nil {
+		return nil, err
 	}
-	return 0
-}
-
-func getVidVariant(variants []*m3u8.Variant, wantRes string) *m3u8.Variant {
-	for _, variant := range variants {
-		if strings.HasSuffix(variant.Resolution, "x"+wantRes) {
-			return variant
-		}
+	// Marker, metadata block header, then the 34-byte STREAMINFO which is always first.
+	buf := make([]byte, 4+4+34)
+	_, err = io.ReadFull(f, buf)
+	if err != nil {
+		return nil, err
 	}
-	return nil
-}
-
-func formatRes(res string) string {
-	if res == "2160" {
-		return "4K"
-	} else {
-		return res + "p"
+	if string(buf[:4]) != "fLaC" {
+		return nil, errors.New("not a flac file")
+	}
+	if buf[4]&0x7f != 0 {
+		return nil, errors.New("first metadata block isn't streaminfo")
 	}
+	info := buf[8:]
+	streamInfo := &FlacStreamInfo{
+		SampleRate:    int(info[10])<<12 | int(info[11])<<4 | int(info[12])>>4,
+		Channels:      int(info[12]>>1&0x07) + 1,
+		BitsPerSample: int(info[12]&0x01)<<4 | int(info[13]>>4) + 1,
+		TotalSamples: int64(info[13]&0x0f)<<32 | int64(info[14])<<24 |
+			int64(info[15])<<16 | int64(info[16])<<8 | int64(info[17]),
+		MD5: hex.EncodeToString(info[18:34]),
+	}
+	return streamInfo, nil
 }
 
-func chooseVariant(manifestUrl, wantRes string) (*m3u8.Variant, string, error) {
-	origWantRes := wantRes
-	var wantVariant *m3u8.Variant
-	req, err := client.Get(manifestUrl)
+// Picks the artist, album, date and title out of a FLAC's Vorbis comments.
+func readFlacTags(flacPath string) (*TrackTags, error) {
+	f, err := os.Open(flacPath)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
-	defer req.Body.Close()
-	if req.StatusCode != http.StatusOK {
-		return nil, "", errors.New(req.Status)
+	defer f.Close()
+	err = skipId3(f)
+	if err != nil {
+		return nil, err
 	}
-	playlist, _, err := m3u8.DecodeFrom(req.Body, true)
+	marker := make([]byte, 4)
+	_, err = io.ReadFull(f, marker)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
-	master := playlist.(*m3u8.MasterPlaylist)
-	sort.Slice(master.Variants, func(x, y int) bool {
-		return master.Variants[x].Bandwidth > master.Variants[y].Bandwidth
-	})
-	if wantRes == "2160" {
-		variant := master.Variants[0]
-		varRes := strings.SplitN(variant.Resolution, "x", 2)[1]
-		varRes = formatRes(varRes)
-		return variant, varRes, nil
+	if string(marker) != "fLaC" {
+		return nil, errors.New("not a flac file")
 	}
+	header := make([]byte, 4)
 	for {
-		wantVariant = getVidVariant(master.Variants, wantRes)
-		if wantVariant != nil {
-			break
-		} else {
-			wantRes = resFallback[wantRes]
+		_, err = io.ReadFull(f, header)
+		if err != nil {
+			return nil, err
+		}
+		isLast := header[0]&0x80 != 0
+		blockSize := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		if header[0]&0x7f == 4 {
+			block := make([]byte, blockSize)
+			_, err = io.ReadFull(f, block)
+			if err != nil {
+				return nil, err
+			}
+			return parseVorbisComments(block)
+		}
+		if isLast {
+			return nil, errors.New("flac has no vorbis comments")
+		}
+		_, err = f.Seek(blockSize, io.SeekCurrent)
+		if err != nil {
+			return nil, err
 		}
 	}
-	if wantVariant == nil {
-		return nil, "", errors.New("No variant was chosen.")
-	}
-	if wantRes != origWantRes {
-		fmt.Println("Unavailable in your chosen format.")
-	}
-	wantRes = formatRes(wantRes)
-	return wantVariant, wantRes, nil
 }
 
-func getManifestBase(manifestUrl string) (string, string, error) {
-	u, err := url.Parse(manifestUrl)
-	if err != nil {
-		return "", "", err
+// Lengths and counts are little-endian, unlike the rest of FLAC.
+func parseVorbisComments(block []byte) (*TrackTags, error) {
+	errTruncated := errors.New("truncated vorbis comments")
+	readUint32 := func() (int, bool) {
+		if len(block) < 4 {
+			return 0, false
+		}
+		n := int(binary.LittleEndian.Uint32(block[:4]))
+		block = block[4:]
+		return n, true
 	}
-	path := u.Path
-	lastPathIdx := strings.LastIndex(path, "/")
-	base := u.Scheme + "://" + u.Host + path[:lastPathIdx+1]
-	return base, "?" + u.RawQuery, nil
+	vendorLen, ok := readUint32()
+	if !ok || vendorLen > len(block) {
+		return nil, errTruncated
+	}
+	block = block[vendorLen:]
+	commentTotal, ok := readUint32()
+	if !ok {
+		return nil, errTruncated
+	}
+	tags := &TrackTags{}
+	for i := 0; i < commentTotal; i++ {
+		commentLen, ok := readUint32()
+		if !ok || commentLen > len(block) {
+			return nil, errTruncated
+		}
+		key, value, _ := strings.Cut(string(block[:commentLen]), "=")
+		block = block[commentLen:]
+		switch strings.ToUpper(key) {
+		case "ARTIST":
+			tags.Artist = value
+		case "ALBUM":
+			tags.Album = value
+		case "DATE":
+			tags.Date = value
+		case "TITLE":
+			tags.Title = value
+		}
+	}
+	return tags, nil
 }
 
-func getSegUrls(manifestUrl, query string) ([]string, error) {
-	var segUrls []string
-	req, err := client.Get(manifestUrl)
+// Picks the artist, album, date and title out of an M4A's iTunes metadata.
+func readMp4Tags(mp4Path string) (*TrackTags, error) {
+	f, err := os.Open(mp4Path)
 	if err != nil {
 		return nil, err
 	}
-	defer req.Body.Close()
-	if req.StatusCode != http.StatusOK {
-		return nil, errors.New(req.Status)
-	}
-	playlist, _, err := m3u8.DecodeFrom(req.Body, true)
+	defer f.Close()
+	stat, err := f.Stat()
 	if err != nil {
 		return nil, err
 	}
-	media := playlist.(*m3u8.MediaPlaylist)
-	for _, seg := range media.Segments {
-		if seg == nil {
-			break
+	start, end := int64(0), stat.Size()
+	for _, boxType := range []string{"moov", "udta", "meta", "ilst"} {
+		start, end, err = findMp4Box(f, start, end, boxType)
+		if err != nil {
+			return nil, err
+		}
+		if end == 0 {
+			return nil, errors.New("mp4 has no " + boxType + " box")
+		}
+		// meta is a full box, so its children start after the version and flags.
+		if boxType == "meta" {
+			start += 4
+		}
+	}
+	tags := &TrackTags{}
+	for itemType, value := range map[string]*string{
+		"\xa9ART": &tags.Artist,
+		"\xa9alb": &tags.Album,
+		"\xa9day": &tags.Date,
+		"\xa9nam": &tags.Title,
+	} {
+		itemStart, itemEnd, err := findMp4Box(f, start, end, itemType)
+		if err != nil {
+			return nil, err
+		}
+		if itemEnd == 0 {
+			continue
+		}
+		dataStart, dataEnd, err := findMp4Box(f, itemStart, itemEnd, "data")
+		if err != nil {
+			return nil, err
+		}
+		// Skips the data type and locale.
+		if dataEnd-dataStart <= 8 {
+			continue
+		}
+		buf := make([]byte, dataEnd-dataStart-8)
+		_, err = f.ReadAt(buf, dataStart+8)
+		if err != nil {
+			return nil, err
 		}
-		segUrls = append(segUrls, seg.URI+query)
+		*value = string(buf)
 	}
-	return segUrls, nil
+	return tags, nil
 }
 
-func downloadVideo(videoPath, _url string) error {
-	f, err := os.OpenFile(videoPath, os.O_CREATE|os.O_WRONLY, 0755)
+func hashFile(filePath string) (string, string, error) {
+	f, err := os.Open(filePath)
 	if err != nil {
-		return err
+		return "", "", err
 	}
 	defer f.Close()
-
-	stat, err := f.Stat()
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(md5Hash, sha256Hash), f)
 	if err != nil {
-		return err
+		return "", "", err
+	}
+	return hex.EncodeToString(md5Hash.Sum(nil)), hex.EncodeToString(sha256Hash.Sum(nil)), nil
+}
+
+// An unset FLAC audio MD5 is all zeroes.
+func isUnsetMd5(md5Sum string) bool {
+	return strings.Trim(md5Sum, "0") == ""
+}
+
+// Writes to a temp file first so an interrupted write can't truncate the old file.
+func writeFileAtomic(filePath string, data []byte) error {
+	tmpPath := filePath + ".tmp"
+	err := os.WriteFile(tmpPath, data, 0755)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filePath)
+}
+
+// Replaces fname's line in a manifest, or adds it if it's not there yet.
+func updateManifest(manifestPath, fname, line string, isFfp bool) error {
+	var sb strings.Builder
+	lines, err := readTxtFile(manifestPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, oldLine := range lines {
+		oldFname, _, ok := parseManifestLine(oldLine, isFfp)
+		if ok && oldFname == fname {
+			continue
+		}
+		sb.WriteString(oldLine + "\n")
+	}
+	sb.WriteString(line + "\n")
+	return writeFileAtomic(manifestPath, []byte(sb.String()))
+}
+
+// Called as each track is written so an interrupted album still has manifests.
+func addChecksums(albumPath, baseFname, trackPath string) error {
+	fname := filepath.Base(trackPath)
+	md5Sum, sha256Sum, err := hashFile(trackPath)
+	if err != nil {
+		return err
+	}
+	manifestPathNoExt := filepath.Join(albumPath, baseFname)
+	err = updateManifest(manifestPathNoExt+".md5", fname, md5Sum+" *"+fname, false)
+	if err != nil {
+		return err
+	}
+	err = updateManifest(manifestPathNoExt+".sha256", fname, sha256Sum+" *"+fname, false)
+	if err != nil {
+		return err
+	}
+	if strings.ToLower(filepath.Ext(fname)) != ".flac" {
+		return nil
+	}
+	streamInfo, err := readFlacStreamInfo(trackPath)
+	if err != nil {
+		return err
+	}
+	if isUnsetMd5(streamInfo.MD5) {
+		return nil
+	}
+	return updateManifest(manifestPathNoExt+".ffp", fname, fname+":"+streamInfo.MD5, true)
+}
+
+// Handles "hash *fname", "hash  fname" and ffp's "fname:hash".
+func parseManifestLine(line string, isFfp bool) (string, string, bool) {
+	if isFfp {
+		idx := strings.LastIndex(line, ":")
+		if idx == -1 {
+			return "", "", false
+		}
+		return line[:idx], strings.ToLower(line[idx+1:]), true
+	}
+	split := strings.SplitN(line, " ", 2)
+	if len(split) != 2 {
+		return "", "", false
+	}
+	fname := strings.TrimPrefix(strings.TrimLeft(split[1], " "), "*")
+	return fname, strings.ToLower(split[0]), true
+}
+
+func verifyFile(filePath, ext, wantHash string) (bool, error) {
+	if ext == ".ffp" {
+		streamInfo, err := readFlacStreamInfo(filePath)
+		if err != nil {
+			return false, err
+		}
+		return streamInfo.MD5 == wantHash, nil
+	}
+	md5Sum, sha256Sum, err := hashFile(filePath)
+	if err != nil {
+		return false, err
+	}
+	if ext == ".md5" {
+		return md5Sum == wantHash, nil
+	}
+	return sha256Sum == wantHash, nil
+}
+
+func verifyFolder(folPath string) (int, error) {
+	var failed, checked int
+	entries, err := os.ReadDir(folPath)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || !contains(manifestExts, ext) {
+			continue
+		}
+		lines, err := readTxtFile(filepath.Join(folPath, entry.Name()))
+		if err != nil {
+			return 0, err
+		}
+		fmt.Println(entry.Name())
+		for _, line := range lines {
+			if strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+				continue
+			}
+			fname, wantHash, ok := parseManifestLine(line, ext == ".ffp")
+			if !ok {
+				fmt.Println("Malformed line:", line)
+				continue
+			}
+			if ext == ".ffp" && isUnsetMd5(wantHash) {
+				fmt.Println("SKIPPED", fname, "(no FLAC audio MD5)")
+				continue
+			}
+			checked++
+			ok, err := verifyFile(filepath.Join(folPath, fname), ext, wantHash)
+			if err != nil {
+				failed++
+				fmt.Printf("FAILED  %s (%s)\n", fname, err)
+			} else if !ok {
+				failed++
+				fmt.Println("FAILED ", fname)
+			} else {
+				fmt.Println("OK     ", fname)
+			}
+		}
+	}
+	if checked == 0 {
+		return 0, errors.New("no checksum manifests found")
+	}
+	fmt.Printf("%d of %d checks passed.\n", checked-failed, checked)
+	return failed, nil
+}
+
+func loadArchive(archivePath string) (*Archive, error) {
+	archive := &Archive{Tracks: map[string]*ArchiveEntry{}}
+	data, err := os.ReadFile(archivePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return archive, nil
+		}
+		return nil, err
+	}
+	err = json.Unmarshal(data, archive)
+	if err != nil {
+		return nil, err
+	}
+	if archive.Tracks == nil {
+		archive.Tracks = map[string]*ArchiveEntry{}
+	}
+	return archive, nil
+}
+
+func saveArchive(cfg *Config) error {
+	data, err := json.MarshalIndent(cfg.Archive, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(cfg.ArchivePath, data)
+}
+
+// Paths are stored relative to the output path so it can be moved.
+// Only updates the archive in memory, saveArchive writes it out once per release.
+func archiveTrack(cfg *Config, containerID, trackID, format int, trackPath string) error {
+	if cfg.Archive == nil {
+		return nil
+	}
+	relPath, err := filepath.Rel(cfg.OutPath, trackPath)
+	if err != nil {
+		return err
+	}
+	cfg.Archive.Tracks[strconv.Itoa(trackID)] = &ArchiveEntry{
+		ContainerID: containerID,
+		TrackID:     trackID,
+		Format:      format,
+		Path:        filepath.ToSlash(relPath),
+	}
+	return nil
+}
+
+func getArchivedContainer(archive *Archive, folName string) int {
+	if archive == nil {
+		return 0
+	}
+	for _, entry := range archive.Tracks {
+		if strings.SplitN(entry.Path, "/", 2)[0] == folName {
+			return entry.ContainerID
+		}
+	}
+	return 0
+}
+
+func getAlbumFolder(meta *nugs.AlbArtResp) string {
+	albumFolder := meta.ArtistName + " - " + strings.TrimRight(meta.ContainerInfo, " ")
+	if len(albumFolder) > 120 {
+		albumFolder = albumFolder[:120]
+	}
+	return sanitise(albumFolder)
+}
+
+// Matches on the artist, then the album title or performance date.
+func matchesTags(tags *TrackTags, container *nugs.AlbArtResp) bool {
+	if !strings.EqualFold(strings.TrimSpace(tags.Artist), strings.TrimSpace(container.ArtistName)) {
+		return false
+	}
+	if tags.Album != "" && strings.EqualFold(strings.TrimSpace(tags.Album), strings.TrimSpace(container.ContainerInfo)) {
+		return true
+	}
+	perfDate, ok := parsePerfDate(container)
+	return ok && strings.HasPrefix(strings.TrimSpace(tags.Date), perfDate.Format("2006-01-02"))
+}
+
+// Returns nil tags for files that aren't tracks.
+func readTrackTags(trackPath string) (*TrackTags, error) {
+	switch strings.ToLower(filepath.Ext(trackPath)) {
+	case ".flac":
+		return readFlacTags(trackPath)
+	case ".m4a", ".mp4":
+		return readMp4Tags(trackPath)
+	}
+	return nil, nil
+}
+
+// Reads the tags of the first track in the folder that has any.
+func readFolderTags(folPath string) (*TrackTags, error) {
+	entries, err := os.ReadDir(folPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		tags, err := readTrackTags(filepath.Join(folPath, entry.Name()))
+		if err == nil && tags != nil && tags.Artist != "" && (tags.Album != "" || tags.Date != "") {
+			return tags, nil
+		}
+	}
+	return nil, nil
+}
+
+// Reads the container ID from a folder's raw metadata if it was saved.
+func getRawMetaContainer(folPath string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(folPath, rawMetaFname))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	var obj struct {
+		ContainerID int `json:"containerID"`
+	}
+	err = json.Unmarshal(data, &obj)
+	if err != nil {
+		return 0, err
+	}
+	return obj.ContainerID, nil
+}
+
+// Tries the archive and raw metadata first, then searches for the tracks' artist and album tags.
+func matchFolder(ctx context.Context, folPath string, archive *Archive) (int, error) {
+	containerID := getArchivedContainer(archive, filepath.Base(folPath))
+	if containerID != 0 {
+		return containerID, nil
+	}
+	containerID, err := getRawMetaContainer(folPath)
+	if err != nil || containerID != 0 {
+		return containerID, err
+	}
+	tags, err := readFolderTags(folPath)
+	if err != nil || tags == nil {
+		return 0, err
+	}
+	searchStr := tags.Artist + " " + tags.Album
+	if tags.Album == "" {
+		searchStr = tags.Artist + " " + tags.Date
+	}
+	searchMeta, err := api.Search(ctx, searchStr)
+	if err != nil {
+		return 0, err
+	}
+	for _, container := range searchMeta.Response.Containers {
+		if matchesTags(tags, container) {
+			return container.ContainerID, nil
+		}
+	}
+	return 0, nil
+}
+
+func findTrackFile(folPath string, trackNum int, track *nugs.Track) (string, error) {
+	prefix := fmt.Sprintf("%02d. %s", trackNum, sanitise(track.SongTitle))
+	for _, ext := range trackExts {
+		trackPath := filepath.Join(folPath, prefix+ext)
+		exists, err := fileExists(trackPath)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return trackPath, nil
+		}
+	}
+	return findRenamedTrack(folPath, trackNum, track)
+}
+
+// Returns the number a file name starts with, or 0 if it doesn't.
+func getLeadingNum(fname string) int {
+	end := strings.IndexFunc(fname, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	if end == -1 {
+		end = len(fname)
+	}
+	num, _ := strconv.Atoi(fname[:end])
+	return num
+}
+
+// Falls back to files named differently to ours, e.g. "1 - Intro.flac".
+// Files numbered the same are told apart by their title tag,
+// and unnumbered ones are only matched if their title tag is unique.
+func findRenamedTrack(folPath string, trackNum int, track *nugs.Track) (string, error) {
+	entries, err := os.ReadDir(folPath)
+	if err != nil {
+		return "", err
+	}
+	var numMatches, titleMatches []string
+	for _, entry := range entries {
+		fname := entry.Name()
+		if entry.IsDir() || !contains(trackExts, strings.ToLower(filepath.Ext(fname))) {
+			continue
+		}
+		trackPath := filepath.Join(folPath, fname)
+		num := getLeadingNum(fname)
+		if num != 0 && num != trackNum {
+			continue
+		}
+		tags, err := readTrackTags(trackPath)
+		titleMatch := err == nil && tags != nil && strings.EqualFold(
+			strings.TrimSpace(tags.Title), strings.TrimSpace(track.SongTitle))
+		if num == trackNum {
+			if titleMatch {
+				return trackPath, nil
+			}
+			numMatches = append(numMatches, trackPath)
+		} else if titleMatch {
+			titleMatches = append(titleMatches, trackPath)
+		}
+	}
+	if len(numMatches) == 1 {
+		return numMatches[0], nil
+	}
+	if len(numMatches) == 0 && len(titleMatches) == 1 {
+		return titleMatches[0], nil
+	}
+	return "", nil
+}
+
+// Works out the stored format from the file itself as ALAC and AAC share an extension.
+func detectFormat(trackPath string, track *nugs.Track) int {
+	switch strings.ToLower(filepath.Ext(trackPath)) {
+	case ".flac":
+		streamInfo, err := readFlacStreamInfo(trackPath)
+		if err == nil && (streamInfo.BitsPerSample > 16 || streamInfo.SampleRate > 44100) {
+			return 3
+		}
+		return 2
+	case ".m4a":
+		stat, err := os.Stat(trackPath)
+		if err != nil || track.TotalRunningTime == 0 {
+			return 5
+		}
+		kbps := stat.Size() * 8 / 1000 / int64(track.TotalRunningTime)
+		if kbps > 400 {
+			return 1
+		}
+		return 5
+	case ".mp4":
+		return 4
+	}
+	return 0
+}
+
+// Checks the archive first, then falls back to looking at what's in the folder.
+// Archive entries elsewhere, e.g. the same track in a playlist folder, are ignored.
+func getStoredTrack(folPath string, trackNum int, track *nugs.Track, cfg *Config) (string, int, error) {
+	if cfg.Archive != nil {
+		entry, ok := cfg.Archive.Tracks[strconv.Itoa(track.TrackID)]
+		var storedPath string
+		if ok {
+			storedPath = filepath.Join(cfg.OutPath, filepath.FromSlash(entry.Path))
+			ok = filepath.Dir(storedPath) == filepath.Clean(folPath)
+		}
+		if ok {
+			exists, err := fileExists(storedPath)
+			if err != nil {
+				return "", 0, err
+			}
+			if exists {
+				return storedPath, entry.Format, nil
+			}
+		}
+	}
+	trackPath, err := findTrackFile(folPath, trackNum, track)
+	if err != nil || trackPath == "" {
+		return "", 0, err
+	}
+	return trackPath, detectFormat(trackPath, track), nil
+}
+
+func getBestQual(quals []*Quality) *Quality {
+	var best *Quality
+	for _, qual := range quals {
+		if best == nil || qualityRank[qual.Format] > qualityRank[best.Format] {
+			best = qual
+		}
+	}
+	return best
+}
+
+// The API's running times are whole seconds and not always exact.
+func checkDuration(secs float64, wantSecs int) error {
+	if wantSecs <= 0 {
+		return nil
+	}
+	tolerance := math.Max(3, float64(wantSecs)*0.01)
+	if math.Abs(secs-float64(wantSecs)) > tolerance {
+		return fmt.Errorf("%.0f seconds long, expected %d", secs, wantSecs)
+	}
+	return nil
+}
+
+// A truncated FLAC keeps its full length in STREAMINFO, so it's also decoded.
+func checkPartial(ctx context.Context, trackPath string, cfg *Config, track *nugs.Track) error {
+	stat, err := os.Stat(trackPath)
+	if err != nil {
+		return err
+	}
+	if stat.Size() == 0 {
+		return errors.New("empty file")
+	}
+	if strings.ToLower(filepath.Ext(trackPath)) == ".flac" {
+		streamInfo, err := readFlacStreamInfo(trackPath)
+		if err != nil {
+			return err
+		}
+		if streamInfo.SampleRate > 0 && streamInfo.TotalSamples > 0 {
+			secs := float64(streamInfo.TotalSamples) / float64(streamInfo.SampleRate)
+			err = checkDuration(secs, track.TotalRunningTime)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return checkIntegrity(ctx, trackPath, cfg.FfmpegNameStr)
+}
+
+func scanFolder(ctx context.Context, folPath string, cfg *Config, streamParams *nugs.StreamParams) (*ScanResult, error) {
+	folName := filepath.Base(folPath)
+	result := &ScanResult{}
+	containerID, err := matchFolder(ctx, folPath, cfg.Archive)
+	if err != nil {
+		fmt.Println("Failed to search for folder.")
+		return nil, err
+	}
+	if containerID == 0 {
+		fmt.Println(folName + ": no match.")
+		return result, nil
+	}
+	result.Matched = true
+	_meta, err := api.GetAlbumMeta(ctx, strconv.Itoa(containerID))
+	if err != nil {
+		fmt.Println("Failed to get metadata.")
+		return nil, err
+	}
+	meta := _meta.Response
+	fmt.Printf("%s: %d\n", folName, containerID)
+	if len(meta.Tracks) == 0 {
+		return result, nil
+	}
+	quals, err := getTrackQuals(ctx, meta.Tracks[0].TrackID, streamParams)
+	if err != nil {
+		fmt.Println("Failed to get available formats.")
+		return nil, err
+	}
+	bestQual := getBestQual(quals)
+	for trackNum, track := range meta.Tracks {
+		trackNum++
+		trackPath, err := findTrackFile(folPath, trackNum, &track)
+		if err != nil {
+			return nil, err
+		}
+		if trackPath == "" {
+			result.Missing++
+			fmt.Printf("  missing: %02d. %s\n", trackNum, track.SongTitle)
+			continue
+		}
+		err = checkPartial(ctx, trackPath, cfg, &track)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			result.Partial++
+			fmt.Printf("  partial: %s (%s)\n", filepath.Base(trackPath), err)
+			continue
+		}
+		format := detectFormat(trackPath, &track)
+		if qualityRank[bestQual.Format] > qualityRank[format] {
+			result.Upgradable++
+			fmt.Printf("  lower quality: %s, %s available\n", filepath.Base(trackPath), bestQual.Specs)
+		}
+		if cfg.ScanSeed && cfg.Archive != nil {
+			err = archiveTrack(cfg, containerID, track.TrackID, format, trackPath)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if cfg.ScanSeed && cfg.Archive != nil {
+		err = saveArchive(cfg)
+		if err != nil {
+			fmt.Println("Failed to save archive.")
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func scan(ctx context.Context, cfg *Config, streamParams *nugs.StreamParams) error {
+	var folTotal, matched, missing, partial, upgradable int
+	entries, err := os.ReadDir(cfg.OutPath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		folTotal++
+		result, err := scanFolder(ctx, filepath.Join(cfg.OutPath, entry.Name()), cfg, streamParams)
+		if err != nil {
+			handleErr("Folder failed.", err, false)
+			continue
+		}
+		if result.Matched {
+			matched++
+		}
+		missing += result.Missing
+		partial += result.Partial
+		upgradable += result.Upgradable
+	}
+	fmt.Printf(
+		"\n%d of %d folders matched, %d missing, %d partial and %d lower quality tracks.\n",
+		matched, folTotal, missing, partial, upgradable)
+	return nil
+}
+
+func formatSetName(setNum int) string {
+	if setNum < 1 {
+		return "Set"
+	}
+	return fmt.Sprintf("Set %d", setNum)
+}
+
+// Traditional live trading info file layout.
+func writeSetlist(setlistPath string, meta *nugs.AlbArtResp, tracks []nugs.Track) error {
+	var sb strings.Builder
+	sb.WriteString(meta.ArtistName + "\n")
+	perfDate, ok := parsePerfDate(meta)
+	if ok {
+		sb.WriteString(perfDate.Format("2006-01-02") + "\n")
+	} else if meta.PerformanceDate != "" {
+		sb.WriteString(meta.PerformanceDate + "\n")
+	}
+	if meta.VenueName != "" {
+		sb.WriteString(meta.VenueName + "\n")
+	}
+	var location []string
+	for _, part := range []string{meta.VenueCity, meta.VenueState} {
+		if part != "" {
+			location = append(location, part)
+		}
+	}
+	if len(location) > 0 {
+		sb.WriteString(strings.Join(location, ", ") + "\n")
+	}
+	lastSet := -1
+	for trackNum, track := range tracks {
+		if track.SetNum != lastSet {
+			sb.WriteString("\n" + formatSetName(track.SetNum) + ":\n")
+			lastSet = track.SetNum
+		}
+		line := fmt.Sprintf("%02d. %s", trackNum+1, track.SongTitle)
+		if track.HhmmssTotalRunningTime != "" {
+			line += " [" + track.HhmmssTotalRunningTime + "]"
+		}
+		sb.WriteString(line + "\n")
+	}
+	if meta.HhmmssTotalRunningTime != "" {
+		sb.WriteString("\nTotal time: " + meta.HhmmssTotalRunningTime + "\n")
+	}
+	notesHeader := "\nNotes:\n"
+	for _, note := range getNotes(meta) {
+		sb.WriteString(notesHeader + note + "\n")
+		notesHeader = ""
+	}
+	return os.WriteFile(setlistPath, []byte(sb.String()), 0755)
+}
+
+func getNotes(meta *nugs.AlbArtResp) []string {
+	var notes []string
+	for _, note := range meta.Notes {
+		note := strings.TrimSpace(note.Note)
+		if note != "" {
+			notes = append(notes, note)
+		}
+	}
+	return notes
+}
+
+func writeNotes(albumPath string, meta *nugs.AlbArtResp, notes []string) error {
+	if len(notes) > 0 {
+		notesText := strings.Join(notes, "\n\n") + "\n"
+		err := os.WriteFile(filepath.Join(albumPath, "notes.txt"), []byte(notesText), 0755)
+		if err != nil {
+			return err
+		}
+	}
+	if len(meta.Reviews.Items) == 0 {
+		return nil
+	}
+	var sb strings.Builder
+	sb.WriteString("# Reviews of " + meta.ArtistName + " - " + strings.TrimRight(meta.ContainerInfo, " ") + "\n")
+	for _, review := range meta.Reviews.Items {
+		heading := strings.TrimSpace(review.ReviewerName)
+		if heading == "" {
+			heading = "Anonymous"
+		}
+		if review.ReviewDate != "" {
+			heading += " (" + review.ReviewDate + ")"
+		}
+		sb.WriteString("\n## " + heading + "\n\n" + strings.TrimSpace(review.Review) + "\n")
+	}
+	return os.WriteFile(filepath.Join(albumPath, "reviews.md"), []byte(sb.String()), 0755)
+}
+
+// Remuxes the track with the tags added as ffmpeg can't edit them in place.
+func tagComment(ctx context.Context, trackPath, comment, ffmpegNameStr string) error {
+	tmpPath := filepath.Join(filepath.Dir(trackPath), tagTmpName+filepath.Ext(trackPath))
+	var errBuffer bytes.Buffer
+	args := []string{
+		"-hide_banner", "-i", trackPath, "-map", "0", "-c", "copy", "-map_metadata", "0",
+		"-metadata", "comment=" + comment, "-metadata", "description=" + comment, "-y", tmpPath,
+	}
+	cmd := exec.CommandContext(ctx, ffmpegNameStr, args...)
+	cmd.Stderr = &errBuffer
+	err := cmd.Run()
+	if err != nil {
+		os.Remove(tmpPath)
+		errString := fmt.Sprintf("%s\n%s", err, errBuffer.String())
+		return errors.New(errString)
+	}
+	return os.Rename(tmpPath, trackPath)
+}
+
+func getCueFileType(trackPath string) string {
+	switch strings.ToLower(filepath.Ext(trackPath)) {
+	case ".flac":
+		return "FLAC"
+	case ".m4a", ".mp4":
+		return "MP4"
+	}
+	return "WAVE"
+}
+
+// One FILE per track as they're downloaded as separate files.
+func writeAlbumCue(cuePath string, meta *nugs.AlbArtResp, tracks []nugs.Track, trackPaths []string) error {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("PERFORMER \"%s\"\n", escapeCue(meta.ArtistName)))
+	sb.WriteString(fmt.Sprintf("TITLE \"%s\"\n", escapeCue(strings.TrimRight(meta.ContainerInfo, " "))))
+	perfDate, ok := parsePerfDate(meta)
+	if ok {
+		sb.WriteString("REM DATE " + perfDate.Format("2006-01-02") + "\n")
+	}
+	for i, track := range tracks {
+		trackPath := trackPaths[i]
+		if trackPath == "" {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf(
+			"FILE \"%s\" %s\n", escapeCue(filepath.Base(trackPath)), getCueFileType(trackPath)))
+		sb.WriteString(fmt.Sprintf("  TRACK %02d AUDIO\n", i+1))
+		sb.WriteString(fmt.Sprintf("    TITLE \"%s\"\n", escapeCue(track.SongTitle)))
+		sb.WriteString(fmt.Sprintf("    PERFORMER \"%s\"\n", escapeCue(meta.ArtistName)))
+		if track.SetNum > 0 {
+			sb.WriteString(fmt.Sprintf("    REM SET %d\n", track.SetNum))
+		}
+		sb.WriteString("    INDEX 01 00:00:00\n")
+	}
+	return os.WriteFile(cuePath, []byte(sb.String()), 0755)
+}
+
+func album(ctx context.Context, albumID string, cfg *Config, streamParams *nugs.StreamParams, artResp *nugs.AlbArtResp) error {
+	var (
+		meta   *nugs.AlbArtResp
+		tracks []nugs.Track
+	)
+	if albumID == "" {
+		meta = artResp
+		tracks = meta.Songs
+	} else {
+		_meta, err := api.GetAlbumMeta(ctx, albumID)
+		if err != nil {
+			fmt.Println("Failed to get metadata.")
+			return err
+		}
+		meta = _meta.Response
+		tracks = meta.Tracks
+	}
+
+	trackTotal := len(tracks)
+
+	skuID := getVideoSku(meta.Products)
+
+	if skuID == 0 && trackTotal < 1 {
+		return errors.New("release has no tracks or videos")
+	}
+
+	if skuID != 0 {
+		if cfg.SkipVideos {
+			fmt.Println("Video-only album, skipped.")
+			return nil
+		}
+		if cfg.ForceVideo || trackTotal < 1 {
+			return video(ctx, albumID, "", cfg, streamParams, meta, false)
+		}
+	}
+	albumFolder := meta.ArtistName + " - " + strings.TrimRight(meta.ContainerInfo, " ")
+	fmt.Println(albumFolder)
+	if len(albumFolder) > 120 {
+		albumFolder = albumFolder[:120]
+		fmt.Println(
+			"Album folder name was chopped because it exceeds 120 characters.")
+	}
+	albumPath := filepath.Join(cfg.OutPath, sanitise(albumFolder))
+	err := makeDirs(albumPath)
+	if err != nil {
+		fmt.Println("Failed to make album folder.")
+		return err
+	}
+	err = writeSetlist(filepath.Join(albumPath, "setlist.txt"), meta, tracks)
+	if err != nil {
+		handleErr("Failed to write setlist.", err, false)
+	}
+	if cfg.SaveMeta {
+		err = writeRawMeta(filepath.Join(albumPath, rawMetaFname), meta.Raw)
+		if err != nil {
+			handleErr("Failed to write raw metadata.", err, false)
+		}
+	}
+	if cfg.Artwork == "all" {
+		err = downloadArtwork(ctx, filepath.Join(albumPath, "Artwork"), meta)
+		if err != nil {
+			handleErr("Failed to download artwork.", err, false)
+		}
+	}
+	var comment string
+	if cfg.Notes {
+		notes := getNotes(meta)
+		comment = strings.Join(notes, "\n\n")
+		err = writeNotes(albumPath, meta, notes)
+		if err != nil {
+			handleErr("Failed to write notes.", err, false)
+		}
+	}
+	var (
+		m3uEntries   []*M3uEntry
+		firstErr     error
+		failedTracks int
+	)
+	trackPaths := make([]string, trackTotal)
+	for trackNum, track := range tracks {
+		trackNum++
+		trackPath, err := processTrack(ctx,
+			albumPath, trackNum, trackTotal, meta.ContainerID, cfg, &track, streamParams, comment)
+		if errors.Is(err, errNotStored) {
+			fmt.Println("Track isn't stored locally, skipped as only upgrading.")
+			continue
+		}
+		if err != nil {
+			handleErr("Track failed.", err, false)
+			failedTracks++
+			if firstErr == nil {
+				firstErr = err
+			}
+			// The rest would fail the same way.
+			if errors.Is(err, nugs.ErrUnauthorized) || ctx.Err() != nil {
+				failedTracks = trackTotal - len(m3uEntries)
+				break
+			}
+			continue
+		}
+		trackPaths[trackNum-1] = trackPath
+		if cfg.Checksums {
+			err = addChecksums(albumPath, sanitise(albumFolder), trackPath)
+			if err != nil {
+				handleErr("Failed to write checksums.", err, false)
+			}
+		}
+		m3uEntries = append(m3uEntries, &M3uEntry{
+			Path:     trackPath,
+			Title:    meta.ArtistName + " - " + track.SongTitle,
+			Duration: track.TotalRunningTime,
+		})
+	}
+	if cfg.Archive != nil && len(m3uEntries) > 0 {
+		err = saveArchive(cfg)
+		if err != nil {
+			handleErr("Failed to save archive.", err, false)
+		}
+	}
+	if cfg.Cue && len(m3uEntries) > 0 {
+		err = writeAlbumCue(filepath.Join(albumPath, sanitise(albumFolder)+".cue"), meta, tracks, trackPaths)
+		if err != nil {
+			handleErr("Failed to write CUE.", err, false)
+		}
+	}
+	if cfg.AlbumM3u && len(m3uEntries) > 0 {
+		err = writeM3u(filepath.Join(albumPath, sanitise(albumFolder)+".m3u8"), m3uEntries)
+		if err != nil {
+			handleErr("Failed to write album M3U.", err, false)
+		}
+	}
+	// Wrapped so callers can still check for nugs.ErrUnauthorized.
+	if firstErr != nil {
+		return fmt.Errorf("%d of %d tracks failed: %w", failedTracks, trackTotal, firstErr)
+	}
+	return nil
+}
+
+func getAlbumTotal(meta []*nugs.ArtistMeta) int {
+	var total int
+	for _, _meta := range meta {
+		total += len(_meta.Response.Containers)
+	}
+	return total
+}
+
+func matchesFilter(container *nugs.AlbArtResp, filter *ContainerFilter) bool {
+	if filter.ContainerType != "" && !strings.EqualFold(container.ContainerTypeStr, filter.ContainerType) {
+		return false
+	}
+	if filter.State != "" && !strings.EqualFold(strings.TrimSpace(container.VenueState), filter.State) {
+		return false
+	}
+	if filter.VenueContains != "" {
+		venue := strings.ToLower(container.VenueName + " " + container.Venue)
+		if !strings.Contains(venue, strings.ToLower(filter.VenueContains)) {
+			return false
+		}
+	}
+	if filter.Since.IsZero() && filter.Until.IsZero() && filter.Year == 0 {
+		return true
+	}
+	perfDate, ok := parsePerfDate(container)
+	if !ok {
+		return false
+	}
+	if filter.Year != 0 && perfDate.Year() != filter.Year {
+		return false
+	}
+	if !filter.Since.IsZero() && perfDate.Before(filter.Since) {
+		return false
+	}
+	if !filter.Until.IsZero() && perfDate.After(filter.Until) {
+		return false
+	}
+	return true
+}
+
+func filterContainers(meta []*nugs.ArtistMeta, filter *ContainerFilter) []*nugs.AlbArtResp {
+	var filtered []*nugs.AlbArtResp
+	for _, _meta := range meta {
+		for _, container := range _meta.Response.Containers {
+			if matchesFilter(container, filter) {
+				filtered = append(filtered, container)
+			}
+		}
+	}
+	return filtered
+}
+
+func parseFilter(args *Args) (*ContainerFilter, error) {
+	var err error
+	filter := &ContainerFilter{
+		Year:          args.Year,
+		VenueContains: args.VenueContains,
+		State:         args.State,
+		ContainerType: args.ContainerType,
+	}
+	if args.Since != "" {
+		filter.Since, err = time.Parse("2006-01-02", args.Since)
+		if err != nil {
+			return nil, errors.New("since must be formatted as YYYY-MM-DD")
+		}
+	}
+	if args.Until != "" {
+		filter.Until, err = time.Parse("2006-01-02", args.Until)
+		if err != nil {
+			return nil, errors.New("until must be formatted as YYYY-MM-DD")
+		}
+	}
+	if reflect.ValueOf(*filter).IsZero() {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+func artistContainer(ctx context.Context, container *nugs.AlbArtResp, cfg *Config, streamParams *nugs.StreamParams) error {
+	if cfg.SkipVideos {
+		return album(ctx, "", cfg, streamParams, container)
+	}
+	// Can't re-use this metadata as it doesn't have any product info for videos.
+	return album(ctx, strconv.Itoa(container.ContainerID), cfg, streamParams, nil)
+}
+
+func loadSyncState(statePath string) (*SyncState, error) {
+	state := &SyncState{Artists: map[string]*ArtistSyncState{}}
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, err
+	}
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, err
+	}
+	if state.Artists == nil {
+		state.Artists = map[string]*ArtistSyncState{}
+	}
+	return state, nil
+}
+
+func saveSyncState(statePath string, state *SyncState) error {
+	data, err := json.MarshalIndent(state, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(statePath, data, 0755)
+}
+
+func isNewContainer(container *nugs.AlbArtResp, lastSeen *ArtistSyncState) bool {
+	if lastSeen == nil {
+		return true
+	}
+	return container.EpochDateCreated > lastSeen.EpochDateCreated &&
+		container.ContainerID != lastSeen.ContainerID
+}
+
+// Pages through the artist's containers and keeps the ones added since lastSeen.
+func getNewContainers(ctx context.Context, artistId string, lastSeen *ArtistSyncState) ([]*nugs.AlbArtResp, error) {
+	var newContainers []*nugs.AlbArtResp
+	// The API's order isn't guaranteed, so only a page with nothing new on it ends paging.
+	stop := func(page *nugs.ArtistMeta) bool {
+		for _, container := range page.Response.Containers {
+			if isNewContainer(container, lastSeen) {
+				return false
+			}
+		}
+		return true
+	}
+	meta, err := api.GetArtistMeta(ctx, artistId, stop)
+	if err != nil {
+		return nil, err
+	}
+	for _, _meta := range meta {
+		for _, container := range _meta.Response.Containers {
+			if isNewContainer(container, lastSeen) {
+				newContainers = append(newContainers, container)
+			}
+		}
+	}
+	// Oldest first so the state can be moved forward as each one finishes.
+	sort.SliceStable(newContainers, func(x, y int) bool {
+		return newContainers[x].EpochDateCreated < newContainers[y].EpochDateCreated
+	})
+	return newContainers, nil
+}
+
+// Item failures go to logger if it isn't nil. A rejected session stops the sync.
+func syncArtist(ctx context.Context, artistId string, cfg *Config, streamParams *nugs.StreamParams, logger *log.Logger) error {
+	state, err := loadSyncState(cfg.SyncStatePath)
+	if err != nil {
+		fmt.Println("Failed to load sync state.")
+		return err
+	}
+	lastSeen := state.Artists[artistId]
+	if lastSeen == nil {
+		fmt.Println("Artist hasn't been synced before, fetching the whole catalog.")
+	}
+	containers, err := getNewContainers(ctx, artistId, lastSeen)
+	if err != nil {
+		fmt.Println("Failed to get artist metadata.")
+		return err
+	}
+	albumTotal := len(containers)
+	if albumTotal == 0 {
+		fmt.Println("No new releases.")
+		return nil
+	}
+	fmt.Printf("%s: %d new releases.\n", containers[0].ArtistName, albumTotal)
+	// Stop moving the state forward after a failure so it's retried next sync.
+	advance := true
+	for albumNum, container := range containers {
+		fmt.Printf("Item %d of %d:\n", albumNum+1, albumTotal)
+		// Filtered out ones are still moved past so they aren't fetched again.
+		if cfg.Filter != nil && !matchesFilter(container, cfg.Filter) {
+			fmt.Println("Doesn't match the filters, skipped.")
+			err = nil
+		} else {
+			err = artistContainer(ctx, container, cfg, streamParams)
+		}
+		if errors.Is(err, nugs.ErrUnauthorized) {
+			return err
+		}
+		if err != nil {
+			if logger != nil {
+				logger.Printf("Artist %s item %d failed: %s\n", artistId, container.ContainerID, err)
+			} else {
+				handleErr("Item failed.", err, false)
+			}
+			advance = false
+			continue
+		}
+		if !advance {
+			continue
+		}
+		state.Artists[artistId] = &ArtistSyncState{
+			ContainerID:      container.ContainerID,
+			DateCreated:      container.DateCreated,
+			EpochDateCreated: container.EpochDateCreated,
+		}
+		err = saveSyncState(cfg.SyncStatePath, state)
+		if err != nil {
+			fmt.Println("Failed to save sync state.")
+			return err
+		}
+	}
+	return nil
+}
+
+func artist(ctx context.Context, artistId string, cfg *Config, streamParams *nugs.StreamParams) error {
+	meta, err := api.GetArtistMeta(ctx, artistId, nil)
+	if err != nil {
+		fmt.Println("Failed to get artist metadata.")
+		return err
+	}
+	if len(meta) == 0 {
+		return errors.New(
+			"The API didn't return any artist metadata.")
+	}
+	fmt.Println(meta[0].Response.Containers[0].ArtistName)
+	if cfg.Filter != nil {
+		containers := filterContainers(meta, cfg.Filter)
+		albumTotal := len(containers)
+		fmt.Printf("%d of %d items match the filters.\n", albumTotal, getAlbumTotal(meta))
+		for albumNum, container := range containers {
+			fmt.Printf("Item %d of %d:\n", albumNum+1, albumTotal)
+			err = artistContainer(ctx, container, cfg, streamParams)
+			if err != nil {
+				handleErr("Item failed.", err, false)
+			}
+		}
+		return nil
+	}
+	albumTotal := getAlbumTotal(meta)
+	for _, _meta := range meta {
+		for albumNum, container := range _meta.Response.Containers {
+			fmt.Printf("Item %d of %d:\n", albumNum+1, albumTotal)
+			err = artistContainer(ctx, container, cfg, streamParams)
+			if err != nil {
+				handleErr("Item failed.", err, false)
+			}
+		}
+	}
+	return nil
+}
+
+func playlist(ctx context.Context, plistId, legacyToken string, cfg *Config, streamParams *nugs.StreamParams, cat bool) error {
+	if !cat && cfg.User == "" {
+		return errNoUser
+	}
+	_meta, err := api.GetPlistMeta(ctx, plistId, cfg.User, legacyToken, cat)
+	if err != nil {
+		fmt.Println("Failed to get playlist metadata.")
+		return err
+	}
+	meta := _meta.Response
+	plistName := meta.PlayListName
+	fmt.Println(plistName)
+	if len(plistName) > 120 {
+		plistName = plistName[:120]
+		fmt.Println(
+			"Playlist folder name was chopped because it exceeds 120 characters.")
+	}
+	mirror := cfg.MirrorPlists && !cat
+	plistFolder := sanitise(plistName)
+	// Keyed by ID too as playlists can share a name, and pruning one mustn't touch the other's tracks.
+	if mirror {
+		plistFolder = strings.TrimSpace(plistFolder + " [" + plistId + "]")
+	}
+	plistPath := filepath.Join(cfg.OutPath, plistFolder)
+	err = makeDirs(plistPath)
+	if err != nil {
+		fmt.Println("Failed to make playlist folder.")
+		return err
+	}
+	if cfg.SaveMeta {
+		err = writeRawMeta(filepath.Join(plistPath, rawMetaFname), _meta.Raw)
+		if err != nil {
+			handleErr("Failed to write raw metadata.", err, false)
+		}
+	}
+	var plistState *PlistState
+	if mirror {
+		plistState, err = loadPlistState(filepath.Join(plistPath, plistStateName))
+		if err != nil {
+			fmt.Println("Failed to load playlist state.")
+			return err
+		}
+		tracks := make([]nugs.Track, len(meta.Items))
+		for i, item := range meta.Items {
+			tracks[i] = item.Track
+		}
+		err = moveReorderedTracks(plistPath, tracks, plistState)
+		if err != nil {
+			fmt.Println("Failed to rename reordered tracks.")
+			return err
+		}
+	}
+	var (
+		m3uEntries []*M3uEntry
+		keep       []string
+		failed     bool
+	)
+	newState := &PlistState{Tracks: map[string]string{}}
+	trackTotal := len(meta.Items)
+	for trackNum, track := range meta.Items {
+		trackNum++
+		trackPath, err := processTrack(ctx,
+			plistPath, trackNum, trackTotal, track.PlaylistContainer.ContainerID, cfg, &track.Track, streamParams, "")
+		if errors.Is(err, errNotStored) {
+			fmt.Println("Track isn't stored locally, skipped as only upgrading.")
+			continue
+		}
+		if err != nil {
+			handleErr("Track failed.", err, false)
+			failed = true
+			// Its file from an earlier run is still there.
+			if mirror {
+				trackId := strconv.Itoa(track.Track.TrackID)
+				oldFname, ok := plistState.Tracks[trackId]
+				if ok {
+					newState.Tracks[trackId] = oldFname
+				}
+			}
+			continue
+		}
+		if filepath.Dir(trackPath) == filepath.Clean(plistPath) {
+			keep = append(keep, filepath.Base(trackPath))
+			newState.Tracks[strconv.Itoa(track.Track.TrackID)] = filepath.Base(trackPath)
+		}
+		m3uEntries = append(m3uEntries, &M3uEntry{
+			Path:     trackPath,
+			Title:    track.PlaylistContainer.ArtistName + " - " + track.Track.SongTitle,
+			Duration: track.Track.TotalRunningTime,
+		})
+	}
+	if cfg.Archive != nil && len(m3uEntries) > 0 {
+		err = saveArchive(cfg)
+		if err != nil {
+			handleErr("Failed to save archive.", err, false)
+		}
+	}
+	if len(m3uEntries) > 0 {
+		err = writeM3u(filepath.Join(plistPath, sanitise(plistName)+".m3u8"), m3uEntries)
+		if err != nil {
+			handleErr("Failed to write playlist M3U.", err, false)
+		}
+	}
+	if mirror {
+		// An empty response or nameless playlist would otherwise wipe the folder or output path.
+		if len(meta.Items) == 0 || filepath.Clean(plistPath) == filepath.Clean(cfg.OutPath) {
+			fmt.Println("Not removing dropped tracks as the playlist is empty or has no folder of its own.")
+			return nil
+		}
+		err = savePlistState(filepath.Join(plistPath, plistStateName), newState)
+		if err != nil {
+			handleErr("Failed to save playlist state.", err, false)
+		}
+		// A failed track's old file may still be wanted.
+		if failed {
+			fmt.Println("Not removing dropped tracks as some tracks failed.")
+			return nil
+		}
+		err = pruneFolder(plistPath, keep)
+		if err != nil {
+			fmt.Println("Failed to remove dropped tracks.")
+			return err
+		}
+	}
+	return nil
+}
+
+// Deletes tracks left over from earlier runs whose file names aren't in keep.
+func pruneFolder(folPath string, keep []string) error {
+	entries, err := os.ReadDir(folPath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		fname := entry.Name()
+		if entry.IsDir() || !contains(trackExts, strings.ToLower(filepath.Ext(fname))) {
+			continue
+		}
+		trackPath := filepath.Join(folPath, fname)
+		if contains(keep, fname) {
+			continue
+		}
+		fmt.Println("Removing dropped track: " + fname)
+		err = os.Remove(trackPath)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadPlistState(statePath string) (*PlistState, error) {
+	state := &PlistState{Tracks: map[string]string{}}
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, err
+	}
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, err
+	}
+	if state.Tracks == nil {
+		state.Tracks = map[string]string{}
+	}
+	return state, nil
+}
+
+func savePlistState(statePath string, state *PlistState) error {
+	data, err := json.MarshalIndent(state, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(statePath, data)
+}
+
+// Tracks are named by position, so ones that moved since the last run are renamed
+// by track ID to their new position instead of being downloaded again.
+// Goes through temp names first as two tracks can swap places.
+func moveReorderedTracks(plistPath string, tracks []nugs.Track, state *PlistState) error {
+	var tmpPaths, newPaths []string
+	for trackNum, track := range tracks {
+		trackNum++
+		oldFname, ok := state.Tracks[strconv.Itoa(track.TrackID)]
+		if !ok {
+			continue
+		}
+		newFname := fmt.Sprintf(
+			"%02d. %s%s", trackNum, sanitise(track.SongTitle), filepath.Ext(oldFname))
+		if newFname == oldFname {
+			continue
+		}
+		oldPath := filepath.Join(plistPath, oldFname)
+		exists, err := fileExists(oldPath)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		tmpPath := oldPath + ".moving"
+		err = os.Rename(oldPath, tmpPath)
+		if err != nil {
+			return err
+		}
+		tmpPaths = append(tmpPaths, tmpPath)
+		newPaths = append(newPaths, filepath.Join(plistPath, newFname))
+		state.Tracks[strconv.Itoa(track.TrackID)] = newFname
+	}
+	for i, tmpPath := range tmpPaths {
+		fmt.Println("Renaming reordered track: " + filepath.Base(newPaths[i]))
+		err := os.Rename(tmpPath, newPaths[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mirrorPlists(ctx context.Context, legacyToken string, cfg *Config, streamParams *nugs.StreamParams) error {
+	if cfg.User == "" {
+		return errNoUser
+	}
+	plists, err := api.GetUserPlists(ctx, cfg.User, legacyToken)
+	if err != nil {
+		fmt.Println("Failed to get user playlists.")
+		return err
+	}
+	plistTotal := len(plists.Response.Items)
+	if plistTotal == 0 {
+		fmt.Println("No playlists.")
+		return nil
+	}
+	for plistNum, plist := range plists.Response.Items {
+		fmt.Printf("Playlist %d of %d:\n", plistNum+1, plistTotal)
+		err = playlist(ctx, strconv.Itoa(plist.ID), legacyToken, cfg, streamParams, false)
+		if err != nil {
+			handleErr("Playlist failed.", err, false)
+		}
+	}
+	return nil
+}
+
+func getVideoSku(products []nugs.Product) int {
+	for _, product := range products {
+		formatStr := product.FormatStr
+		if formatStr == "VIDEO ON DEMAND" || formatStr == "LIVE HD VIDEO" {
+			return product.SkuID
+		}
+	}
+	return 0
+}
+
+func getLstreamSku(products []*nugs.ProductFormatList) int {
+	for _, product := range products {
+		if product.FormatStr == "LIVE HD VIDEO" {
+			return product.SkuID
+		}
+	}
+	return 0
+}
+
+func getVariantHeight(variant *m3u8.Variant) int {
+	split := strings.SplitN(variant.Resolution, "x", 2)
+	if len(split) != 2 {
+		return 0
+	}
+	height, err := strconv.Atoi(split[1])
+	if err != nil {
+		return 0
+	}
+	return height
+}
+
+// Variants must already be sorted by bandwidth, highest first.
+func getVidVariant(variants []*m3u8.Variant, height int) *m3u8.Variant {
+	for _, variant := range variants {
+		if getVariantHeight(variant) == height {
+			return variant
+		}
+	}
+	return nil
+}
+
+func getSortedHeights(variants []*m3u8.Variant) []int {
+	var heights []int
+	seen := map[int]bool{}
+	for _, variant := range variants {
+		height := getVariantHeight(variant)
+		if height != 0 && !seen[height] {
+			seen[height] = true
+			heights = append(heights, height)
+		}
+	}
+	sort.Ints(heights)
+	return heights
+}
+
+// Nearest lower height first, then nearest higher.
+func getFallbackHeight(heights []int, wantHeight int) int {
+	for i := len(heights) - 1; i >= 0; i-- {
+		if heights[i] <= wantHeight {
+			return heights[i]
+		}
+	}
+	if len(heights) > 0 {
+		return heights[0]
+	}
+	return 0
+}
+
+func formatRes(res string) string {
+	if res == "2160" {
+		return "4K"
+	} else {
+		return res + "p"
+	}
+}
+
+func getMasterPlaylist(ctx context.Context, manifestUrl string) (*m3u8.MasterPlaylist, error) {
+	req, err := httpGet(ctx, manifestUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer req.Body.Close()
+	if req.StatusCode != http.StatusOK {
+		return nil, errors.New(req.Status)
+	}
+	playlist, _, err := m3u8.DecodeFrom(req.Body, true)
+	if err != nil {
+		return nil, err
+	}
+	master, ok := playlist.(*m3u8.MasterPlaylist)
+	if !ok {
+		return nil, errors.New("manifest isn't a master playlist")
+	}
+	if len(master.Variants) == 0 {
+		return nil, errors.New("master playlist has no variants")
+	}
+	sort.SliceStable(master.Variants, func(x, y int) bool {
+		return master.Variants[x].Bandwidth > master.Variants[y].Bandwidth
+	})
+	return master, nil
+}
+
+func chooseVariant(ctx context.Context, manifestUrl string, cfg *Config) (*m3u8.Variant, string, error) {
+	var wantVariant *m3u8.Variant
+	master, err := getMasterPlaylist(ctx, manifestUrl)
+	if err != nil {
+		return nil, "", err
+	}
+	variants := master.Variants
+	variantTotal := len(variants)
+	if cfg.VariantNum > 0 {
+		if cfg.VariantNum > variantTotal {
+			return nil, "", fmt.Errorf(
+				"variant %d was chosen, but only %d are available", cfg.VariantNum, variantTotal)
+		}
+		wantVariant = variants[cfg.VariantNum-1]
+	} else if cfg.MaxBitrate {
+		wantVariant = variants[0]
+	} else {
+		wantHeight, _ := strconv.Atoi(cfg.WantRes)
+		height := getFallbackHeight(getSortedHeights(variants), wantHeight)
+		wantVariant = getVidVariant(variants, height)
+		if wantVariant == nil {
+			// Resolution wasn't parsable for any of them.
+			wantVariant = variants[0]
+		} else if height != wantHeight && cfg.VideoFormat != 5 {
+			fmt.Println("Unavailable in your chosen format.")
+		}
+	}
+	retRes := formatRes(strconv.Itoa(getVariantHeight(wantVariant)))
+	return wantVariant, retRes, nil
+}
+
+func getManifestBase(manifestUrl string) (string, string, error) {
+	u, err := url.Parse(manifestUrl)
+	if err != nil {
+		return "", "", err
+	}
+	path := u.Path
+	lastPathIdx := strings.LastIndex(path, "/")
+	base := u.Scheme + "://" + u.Host + path[:lastPathIdx+1]
+	return base, "?" + u.RawQuery, nil
+}
+
+func getSegPlaylist(ctx context.Context, manifestUrl, query string) (*SegPlaylist, error) {
+	req, err := httpGet(ctx, manifestUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer req.Body.Close()
+	if req.StatusCode != http.StatusOK {
+		return nil, errors.New(req.Status)
+	}
+	playlist, _, err := m3u8.DecodeFrom(req.Body, true)
+	if err != nil {
+		return nil, err
+	}
+	media, ok := playlist.(*m3u8.MediaPlaylist)
+	if !ok {
+		return nil, errors.New("not a media playlist")
+	}
+	segPlaylist := &SegPlaylist{
+		SeqNo:          media.SeqNo,
+		TargetDuration: time.Duration(media.TargetDuration * float64(time.Second)),
+		Ended:          media.Closed,
+	}
+	for _, seg := range media.Segments {
+		if seg == nil {
+			break
+		}
+		segPlaylist.SegUrls = append(segPlaylist.SegUrls, seg.URI+query)
+	}
+	return segPlaylist, nil
+}
+
+// Player album page videos are one file split up by byte range, so all their segments share a URI.
+func isSingleFile(segPlaylist *SegPlaylist) bool {
+	if !segPlaylist.Ended || len(segPlaylist.SegUrls) == 0 {
+		return false
+	}
+	for _, segUrl := range segPlaylist.SegUrls {
+		if segUrl != segPlaylist.SegUrls[0] {
+			return false
+		}
+	}
+	return true
+}
+
+func downloadVideo(ctx context.Context, videoPath, _url string) error {
+	f, err := os.OpenFile(videoPath, os.O_CREATE|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
 	}
 	startByte := stat.Size()
 
-	req, err := http.NewRequest(http.MethodGet, _url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, _url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Range", fmt.Sprintf("bytes=%d-", startByte))
+	do, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer do.Body.Close()
+	if do.StatusCode != http.StatusOK && do.StatusCode != http.StatusPartialContent {
+		return errors.New(do.Status)
+	}
+
+	if startByte > 0 {
+		// A 200 means the server ignored the range and is sending the whole file.
+		if do.StatusCode == http.StatusOK {
+			fmt.Println("Server doesn't support resuming, restarting TS download...")
+			err = f.Truncate(0)
+			if err != nil {
+				return err
+			}
+			startByte = 0
+		} else {
+			fmt.Printf("TS already exists locally, resuming from byte %d...\n", startByte)
+		}
+	}
+	_, err = f.Seek(startByte, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	totalBytes := do.ContentLength
+	counter := &WriteCounter{
+		Total:      startByte + totalBytes,
+		TotalStr:   humanize.Bytes(uint64(startByte + totalBytes)),
+		StartTime:  time.Now().UnixMilli(),
+		Downloaded: startByte,
+	}
+	written, err := io.Copy(f, io.TeeReader(do.Body, counter))
+	fmt.Println("")
+	if err != nil {
+		return err
+	}
+	return checkWritten(written, totalBytes)
+}
+
+// Live playlists are re-fetched every target duration and new segments, going by media sequence,
+// are appended until the playlist ends. An empty live playlist is waited on, it's normal at go-live.
+func downloadLstream(ctx context.Context, videoPath, manBaseUrl, mediaUrl, query string) error {
+	f, err := os.OpenFile(videoPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var (
+		nextSeq   uint64
+		segNum    int
+		fetchErrs int
+	)
+	for {
+		segPlaylist, err := getSegPlaylist(ctx, mediaUrl, query)
+		if err != nil {
+			fetchErrs++
+			if fetchErrs == maxRetries || ctx.Err() != nil {
+				fmt.Println("")
+				return err
+			}
+			fmt.Println("")
+			handleErr("Failed to refresh livestream playlist, retrying.", err, false)
+		} else {
+			fetchErrs = 0
+			if segPlaylist.Ended && segNum == 0 && len(segPlaylist.SegUrls) == 0 {
+				return errors.New("video playlist has no segments")
+			}
+			if segNum > 0 && segPlaylist.SeqNo > nextSeq {
+				fmt.Printf("\n%d segments dropped off the playlist before they could be fetched.\n",
+					segPlaylist.SeqNo-nextSeq)
+			}
+			for i, segUrl := range segPlaylist.SegUrls {
+				seq := segPlaylist.SeqNo + uint64(i)
+				if segNum > 0 && seq < nextSeq {
+					continue
+				}
+				segNum++
+				if segPlaylist.Ended {
+					fmt.Printf("\rSegment %d of %d.", segNum, segNum+len(segPlaylist.SegUrls)-i-1)
+				} else {
+					fmt.Printf("\rSegment %d, recording live.", segNum)
+				}
+				err = downloadSeg(ctx, f, manBaseUrl+segUrl)
+				if err != nil {
+					fmt.Println("")
+					return err
+				}
+				nextSeq = seq + 1
+			}
+			if segPlaylist.Ended {
+				break
+			}
+		}
+		wait := 2 * time.Second
+		if segPlaylist != nil && segPlaylist.TargetDuration > 0 {
+			wait = segPlaylist.TargetDuration
+		}
+		err = sleepCtx(ctx, wait)
+		if err != nil {
+			fmt.Println("")
+			return err
+		}
+	}
+	fmt.Println("")
+	return nil
+}
+
+func downloadSeg(ctx context.Context, f *os.File, segUrl string) error {
+	do, err := httpGet(ctx, segUrl)
+	if err != nil {
+		return err
+	}
+	defer do.Body.Close()
+	if do.StatusCode != http.StatusOK {
+		return errors.New(do.Status)
+	}
+	_, err = io.Copy(f, do.Body)
+	return err
+}
+
+func extractDuration(errStr string) string {
+	regex := regexp.MustCompile(durRegex)
+	match := regex.FindStringSubmatch(errStr)
+	if match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+func parseDuration(dur string) (int, error) {
+	dur = strings.Replace(dur, ":", "h", 1)
+	dur = strings.Replace(dur, ":", "m", 1)
+	dur = strings.Replace(dur, ".", "s", 1)
+	dur += "ms"
+	d, err := time.ParseDuration(dur)
+	if err != nil {
+		return 0, err
+	}
+	rounded := math.Round(d.Seconds())
+	return int(rounded), nil
+}
+
+// Horrible, but best way without ffprobe.
+// My native Go duration calculation's too slow. Is there a way without having to iterate over all the packets?
+func getDuration(ctx context.Context, tsPath, ffmpegNameStr string) (int, error) {
+	var errBuffer bytes.Buffer
+	args := []string{"-hide_banner", "-i", tsPath}
+	cmd := exec.CommandContext(ctx, ffmpegNameStr, args...)
+	cmd.Stderr = &errBuffer
+	// Return code's always 1 as we're not providing any output files.
+	err := cmd.Run()
+	if err.Error() != "exit status 1" {
+		return 0, err
+	}
+	errStr := errBuffer.String()
+	ok := strings.HasSuffix(
+		strings.TrimSpace(errStr), "At least one output file must be specified")
+	if !ok {
+		errString := fmt.Sprintf("%s\n%s", err, errStr)
+		return 0, errors.New(errString)
+	}
+	dur := extractDuration(errStr)
+	if dur == "" {
+		return 0, errors.New("No regex match.")
+	}
+	durSecs, err := parseDuration(dur)
+	if err != nil {
+		return 0, err
+	}
+	return durSecs, nil
+}
+
+// Drops chapters with invalid starts, merges ones that start at the same time,
+// and works out each chapter's end from the next one's start.
+func cleanChapters(videoChapters []nugs.VideoChapter, dur int) []*Chapter {
+	var (
+		valid   []nugs.VideoChapter
+		cleaned []*Chapter
+	)
+	durSecs := float64(dur)
+	for _, chapter := range videoChapters {
+		start := chapter.ChapterSeconds
+		if start < 0 || math.IsNaN(start) || (dur > 0 && start >= durSecs) {
+			continue
+		}
+		valid = append(valid, chapter)
+	}
+	sort.SliceStable(valid, func(x, y int) bool {
+		return valid[x].ChapterSeconds < valid[y].ChapterSeconds
+	})
+	for _, chapter := range valid {
+		title := chapter.ChapterName
+		chapCount := len(cleaned)
+		if chapCount > 0 {
+			prev := cleaned[chapCount-1]
+			if chapter.ChapterSeconds-prev.Start < 1 {
+				if title != "" && title != prev.Title {
+					prev.Title += " / " + title
+				}
+				continue
+			}
+		}
+		cleaned = append(cleaned, &Chapter{Title: title, Start: chapter.ChapterSeconds})
+	}
+	for i, chapter := range cleaned {
+		if chapter.Title == "" {
+			chapter.Title = fmt.Sprintf("Chapter %d", i+1)
+		}
+		if i+1 < len(cleaned) {
+			chapter.End = cleaned[i+1].Start
+		} else {
+			chapter.End = durSecs
+		}
+	}
+	// Duration's unknown, so there's no sane end for the last chapter.
+	if len(cleaned) > 0 && cleaned[len(cleaned)-1].End <= cleaned[len(cleaned)-1].Start {
+		cleaned = cleaned[:len(cleaned)-1]
+	}
+	return cleaned
+}
+
+func formatChapTime(secs float64, sep string) string {
+	ms := int64(math.Round(secs * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d",
+		ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+// mm:ss:ff, 75 frames per second.
+func formatCueTime(secs float64) string {
+	frames := int64(math.Round(secs * 75))
+	return fmt.Sprintf("%02d:%02d:%02d", frames/75/60, frames/75%60, frames%75)
+}
+
+func escapeCue(s string) string {
+	return strings.ReplaceAll(s, `"`, "'")
+}
+
+func escapeFfmeta(s string) string {
+	replacer := strings.NewReplacer(
+		`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", `\`+"\n")
+	return replacer.Replace(s)
+}
+
+func escapeXml(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+func buildFfmetaChaps(chapters []*Chapter) string {
+	var sb strings.Builder
+	sb.WriteString(";FFMETADATA1\n")
+	for _, chapter := range chapters {
+		sb.WriteString("\n[CHAPTER]\nTIMEBASE=1/1000\n")
+		sb.WriteString(fmt.Sprintf("START=%d\n", int64(math.Round(chapter.Start*1000))))
+		sb.WriteString(fmt.Sprintf("END=%d\n", int64(math.Round(chapter.End*1000))))
+		sb.WriteString("TITLE=" + escapeFfmeta(chapter.Title) + "\n")
+	}
+	return sb.String()
+}
+
+func buildMkvChaps(chapters []*Chapter) string {
+	var sb strings.Builder
+	sb.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	sb.WriteString("<!DOCTYPE Chapters SYSTEM \"matroskachapters.dtd\">\n")
+	sb.WriteString("<Chapters>\n  <EditionEntry>\n")
+	for _, chapter := range chapters {
+		sb.WriteString("    <ChapterAtom>\n")
+		sb.WriteString("      <ChapterTimeStart>" + formatChapTime(chapter.Start, ".") + "</ChapterTimeStart>\n")
+		sb.WriteString("      <ChapterTimeEnd>" + formatChapTime(chapter.End, ".") + "</ChapterTimeEnd>\n")
+		sb.WriteString("      <ChapterDisplay>\n")
+		sb.WriteString("        <ChapterString>" + escapeXml(chapter.Title) + "</ChapterString>\n")
+		sb.WriteString("        <ChapterLanguage>eng</ChapterLanguage>\n")
+		sb.WriteString("      </ChapterDisplay>\n    </ChapterAtom>\n")
+	}
+	sb.WriteString("  </EditionEntry>\n</Chapters>\n")
+	return sb.String()
+}
+
+func buildCueChaps(chapters []*Chapter, meta *nugs.AlbArtResp, vidFname string) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("PERFORMER \"%s\"\n", escapeCue(meta.ArtistName)))
+	sb.WriteString(fmt.Sprintf("TITLE \"%s\"\n", escapeCue(strings.TrimRight(meta.ContainerInfo, " "))))
+	sb.WriteString(fmt.Sprintf("FILE \"%s\" MP4\n", escapeCue(vidFname)))
+	for i, chapter := range chapters {
+		sb.WriteString(fmt.Sprintf("  TRACK %02d AUDIO\n", i+1))
+		sb.WriteString(fmt.Sprintf("    TITLE \"%s\"\n", escapeCue(chapter.Title)))
+		sb.WriteString(fmt.Sprintf("    PERFORMER \"%s\"\n", escapeCue(meta.ArtistName)))
+		sb.WriteString("    INDEX 01 " + formatCueTime(chapter.Start) + "\n")
+	}
+	return sb.String()
+}
+
+func buildVttChaps(chapters []*Chapter) string {
+	var sb strings.Builder
+	sb.WriteString("WEBVTT\n")
+	for i, chapter := range chapters {
+		sb.WriteString(fmt.Sprintf("\n%d\n%s --> %s\n%s\n", i+1, formatChapTime(chapter.Start, "."),
+			formatChapTime(chapter.End, "."), chapter.Title))
+	}
+	return sb.String()
+}
+
+func writeChapsFile(chapters []*Chapter) error {
+	return os.WriteFile(chapsFileFname, []byte(buildFfmetaChaps(chapters)), 0755)
+}
+
+func exportChaps(vidPathNoExt string, chapters []*Chapter, meta *nugs.AlbArtResp, formats []string) error {
+	for _, format := range formats {
+		var (
+			data string
+			ext  string
+		)
+		switch strings.ToLower(format) {
+		case "ffmeta":
+			data, ext = buildFfmetaChaps(chapters), ".chapters.txt"
+		case "mkvxml":
+			data, ext = buildMkvChaps(chapters), ".chapters.xml"
+		case "cue":
+			data, ext = buildCueChaps(chapters, meta, filepath.Base(vidPathNoExt)+".mp4"), ".cue"
+		case "vtt":
+			data, ext = buildVttChaps(chapters), ".chapters.vtt"
+		}
+		err := os.WriteFile(vidPathNoExt+ext, []byte(data), 0755)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func vidToM4a(ctx context.Context, vidPath, outPath, ffmpegNameStr string) error {
+	var errBuffer bytes.Buffer
+	args := []string{"-hide_banner", "-y", "-i", vidPath, "-vn", "-c:a", "copy", outPath}
+	cmd := exec.CommandContext(ctx, ffmpegNameStr, args...)
+	cmd.Stderr = &errBuffer
+	err := cmd.Run()
+	if err != nil {
+		errString := fmt.Sprintf("%s\n%s", err, errBuffer.String())
+		return errors.New(errString)
+	}
+	return nil
+}
+
+func cutChapAudio(ctx context.Context, inPath, outPath string, start, end float64, tags map[string]string, ffmpegNameStr string) error {
+	var errBuffer bytes.Buffer
+	args := []string{
+		"-hide_banner", "-y", "-ss", strconv.FormatFloat(start, 'f', 3, 64),
+		"-to", strconv.FormatFloat(end, 'f', 3, 64), "-i", inPath, "-c", "copy",
+		"-map_metadata", "-1",
+	}
+	for k, v := range tags {
+		args = append(args, "-metadata", k+"="+v)
+	}
+	args = append(args, outPath)
+	cmd := exec.CommandContext(ctx, ffmpegNameStr, args...)
+	cmd.Stderr = &errBuffer
+	err := cmd.Run()
+	if err != nil {
+		errString := fmt.Sprintf("%s\n%s", err, errBuffer.String())
+		return errors.New(errString)
+	}
+	return nil
+}
+
+// vidPath can be the downloaded TS or an MP4 from an earlier run.
+func extractChapAudio(ctx context.Context, vidPath string, meta *nugs.AlbArtResp, chapters []*Chapter, cfg *Config) error {
+	albumPath := filepath.Join(cfg.OutPath, getAlbumFolder(meta))
+	err := makeDirs(albumPath)
+	if err != nil {
+		fmt.Println("Failed to make album folder.")
+		return err
+	}
+	fmt.Println("Extracting audio...")
+	// Demux once so each cut doesn't have to read through the whole video.
+	err = vidToM4a(ctx, vidPath, vidAudioFname, cfg.FfmpegNameStr)
+	if err != nil {
+		fmt.Println("Failed to extract audio stream.")
+		return err
+	}
+	defer os.Remove(vidAudioFname)
+	chaptersCount := len(chapters)
+	for i, chapter := range chapters {
+		title := chapter.Title
+		trackNum := i + 1
+		trackFname := fmt.Sprintf("%02d. %s.m4a", trackNum, sanitise(title))
+		trackPath := filepath.Join(albumPath, trackFname)
+		exists, err := fileExists(trackPath)
+		if err != nil {
+			fmt.Println("Failed to check if track already exists locally.")
+			return err
+		}
+		if exists {
+			fmt.Println("Track already exists locally.")
+			continue
+		}
+		fmt.Printf("Extracting track %d of %d: %s\n", trackNum, chaptersCount, title)
+		tags := map[string]string{
+			"title":        title,
+			"artist":       meta.ArtistName,
+			"album_artist": meta.ArtistName,
+			"album":        strings.TrimRight(meta.ContainerInfo, " "),
+			"track":        fmt.Sprintf("%d/%d", trackNum, chaptersCount),
+			"date":         meta.PerformanceDateYear,
+		}
+		err = cutChapAudio(ctx,
+			vidAudioFname, trackPath, chapter.Start, chapter.End, tags, cfg.FfmpegNameStr)
+		if err != nil {
+			handleErr("Track failed.", err, false)
+		}
+	}
+	return nil
+}
+
+// There are native MPEG demuxers and MP4 muxers for Go, but they're too slow.
+func tsToMp4(ctx context.Context, VidPathTs, vidPath, ffmpegNameStr string, chapAvail bool) error {
+	var (
+		errBuffer bytes.Buffer
+		args      []string
+	)
+	if chapAvail {
+		args = []string{
+			"-hide_banner", "-i", VidPathTs, "-f", "ffmetadata",
+			"-i", chapsFileFname, "-map_metadata", "1", "-c", "copy", vidPath,
+		}
+	} else {
+		args = []string{"-hide_banner", "-i", VidPathTs, "-c", "copy", vidPath}
+	}
+	cmd := exec.CommandContext(ctx, ffmpegNameStr, args...)
+	cmd.Stderr = &errBuffer
+	err := cmd.Run()
+	if err != nil {
+		errString := fmt.Sprintf("%s\n%s", err, errBuffer.String())
+		return errors.New(errString)
+	}
+	return nil
+}
+
+func getLstreamContainer(containers []*nugs.AlbArtResp) *nugs.AlbArtResp {
+	for i := len(containers) - 1; i >= 0; i-- {
+		c := containers[i]
+		if c.AvailabilityTypeStr == "AVAILABLE" && c.ContainerTypeStr == "Show" {
+			return c
+		}
+	}
+	return nil
+}
+
+func parseLstreamMeta(_meta *nugs.ArtistMeta) *nugs.AlbumMeta {
+	meta := getLstreamContainer(_meta.Response.Containers)
+	parsed := &nugs.AlbumMeta{
+		Response: &nugs.AlbArtResp{
+			ArtistName:        meta.ArtistName,
+			ContainerInfo:     meta.ContainerInfo,
+			ContainerID:       meta.ContainerID,
+			VideoChapters:     meta.VideoChapters,
+			Products:          meta.Products,
+			ProductFormatList: meta.ProductFormatList,
+		},
+	}
+	return parsed
+}
+
+func getVideoManifestUrl(ctx context.Context, videoID, uguID string, meta *nugs.AlbArtResp, streamParams *nugs.StreamParams, isLstream bool) (string, error) {
+	var (
+		skuID       int
+		manifestUrl string
+		err         error
+	)
+	if isLstream {
+		skuID = getLstreamSku(meta.ProductFormatList)
+	} else {
+		skuID = getVideoSku(meta.Products)
+	}
+	if skuID == 0 {
+		return "", errors.New("no video available")
+	}
+	if uguID == "" {
+		manifestUrl, err = api.GetStreamMeta(
+			ctx, meta.ContainerID, skuID, 0, streamParams)
+	} else {
+		manifestUrl, err = api.GetPurchasedManUrl(
+			ctx, skuID, videoID, streamParams.UserID, uguID)
+	}
+	if err != nil {
+		return "", err
+	} else if manifestUrl == "" {
+		return "", errors.New("the api didn't return a video manifest url")
+	}
+	return manifestUrl, nil
+}
+
+func video(ctx context.Context, videoID, uguID string, cfg *Config, streamParams *nugs.StreamParams, _meta *nugs.AlbArtResp, isLstream bool) error {
+	var (
+		chapsAvail bool
+		manifestUrl string
+		meta *nugs.AlbArtResp
+		err error
+	)
+
+	if _meta != nil {
+		meta = _meta
+	} else {
+		m, err := api.GetAlbumMeta(ctx, videoID)
+		if err != nil {
+			fmt.Println("Failed to get metadata.")
+			return err
+		}
+		meta = m.Response
+	}
+
+	hasChaps := len(meta.VideoChapters) > 0
+	chapsAvail = hasChaps && !cfg.SkipChapters
+	
+	videoFname := meta.ArtistName + " - " + strings.TrimRight(meta.ContainerInfo, " ")
+	fmt.Println(videoFname)
+	if len(videoFname) > 110 {
+		videoFname = videoFname[:110]
+		fmt.Println(
+			"Video filename was chopped because it exceeds 120 characters.")
+	}
+	manifestUrl, err = getVideoManifestUrl(ctx, videoID, uguID, meta, streamParams, isLstream)
+	if err != nil {
+		fmt.Println("Failed to get video file metadata.")
+		return err
+	}
+	variant, retRes, err := chooseVariant(ctx, manifestUrl, cfg)
+	if err != nil {
+		fmt.Println("Failed to get video master manifest.")
+		return err
+	}
+	vidFolPath := cfg.OutPath
+	// NFOs named movie.nfo or musicvideo.nfo need a folder per video.
+	if cfg.Nfo != "" {
+		vidFolPath = filepath.Join(cfg.OutPath, sanitise(videoFname))
+		err = makeDirs(vidFolPath)
+		if err != nil {
+			fmt.Println("Failed to make video folder.")
+			return err
+		}
+	}
+	vidPathNoExt := filepath.Join(vidFolPath, sanitise(videoFname+"_"+retRes))
+	VidPathTs := vidPathNoExt + ".ts"
+	vidPath := vidPathNoExt + ".mp4"
+	exists, err := fileExists(vidPath)
+	if err != nil {
+		fmt.Println("Failed to check if video already exists locally.")
+		return err
+	}
+	if exists {
+		fmt.Println("Video already exists locally.")
+		if hasChaps && cfg.VideoAudio {
+			err = extractExistingAudio(ctx, vidPath, meta, cfg)
+			if err != nil {
+				handleErr("Failed to extract audio from video.", err, false)
+			}
+		}
+		return nil
+	}
+	manBaseUrl, query, err := getManifestBase(manifestUrl)
+	if err != nil {
+		fmt.Println("Failed to get video manifest base URL.")
+		return err
+	}
+
+	mediaUrl := manBaseUrl + variant.URI
+	segPlaylist, err := getSegPlaylist(ctx, mediaUrl, query)
+	if err != nil {
+		fmt.Println("Failed to get video segment URLs.")
+		return err
+	}
+	isLstream = !isSingleFile(segPlaylist)
+
+	if !isLstream {
+		fmt.Printf("%.3f FPS, ", variant.FrameRate)
+	}
+	fmt.Printf("%d Kbps, %s (%s)\n",
+		variant.Bandwidth/1000, retRes, variant.Resolution)
+	var (
+		chapters []*Chapter
+		dur      int
+	)
+	extractAudio := hasChaps && cfg.VideoAudio
+	exportChapters := hasChaps && len(cfg.ChapterFormats) > 0
+	writeNfo := cfg.Nfo != ""
+	// A corrupt MP4 is deleted along with its TS and fetched again from scratch.
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		err = getVideoTs(ctx, VidPathTs, manBaseUrl, mediaUrl, query, segPlaylist, isLstream)
+		if err != nil {
+			fmt.Println("Failed to download video segments.")
+			return err
+		}
+		if chapsAvail || extractAudio || exportChapters || writeNfo {
+			dur, err = getDuration(ctx, VidPathTs, cfg.FfmpegNameStr)
+			if err != nil {
+				fmt.Println("Failed to get TS duration.")
+				return err
+			}
+			chapters = cleanChapters(meta.VideoChapters, dur)
+			if hasChaps && len(chapters) == 0 {
+				fmt.Println("Video has no usable chapters.")
+				chapsAvail, extractAudio, exportChapters = false, false, false
+			}
+		}
+		if chapsAvail {
+			err = writeChapsFile(chapters)
+			if err != nil {
+				fmt.Println("Failed to write chapters file.")
+				return err
+			}
+		}
+		fmt.Println("Putting into MP4 container...")
+		err = tsToMp4(ctx, VidPathTs, vidPath, cfg.FfmpegNameStr, chapsAvail)
+		if err != nil {
+			fmt.Println("Failed to put TS into MP4 container.")
+			return err
+		}
+		if !cfg.CheckIntegrity {
+			break
+		}
+		err = checkMp4(vidPath)
+		if err == nil {
+			break
+		}
+		os.Remove(vidPath)
+		os.Remove(VidPathTs)
+		if chapsAvail {
+			os.Remove(chapsFileFname)
+		}
+		if attempt == maxRetries {
+			fmt.Println("MP4 failed integrity check.")
+			return err
+		}
+		handleErr(fmt.Sprintf("MP4 failed integrity check, retrying (%d of %d).", attempt, maxRetries-1), err, false)
+	}
+	if chapsAvail {
+		err = os.Remove(chapsFileFname)
+		if err != nil {
+			fmt.Println("Failed to delete chapters file.")
+		}
+	}
+	if exportChapters {
+		err = exportChaps(vidPathNoExt, chapters, meta, cfg.ChapterFormats)
+		if err != nil {
+			handleErr("Failed to export chapters.", err, false)
+		}
+	}
+	if writeNfo {
+		err = writeVideoNfo(ctx, vidFolPath, meta, chapters, dur, cfg.Nfo)
+		if err != nil {
+			handleErr("Failed to write NFO.", err, false)
+		}
+	}
+	if extractAudio {
+		err = extractChapAudio(ctx, VidPathTs, meta, chapters, cfg)
+		if err != nil {
+			handleErr("Failed to extract audio from video.", err, false)
+		}
+	}
+	err = os.Remove(VidPathTs)
+	if err != nil {
+		fmt.Println("Failed to delete TS.")
+	}
+	return nil
+}
+
+// Interrupted single-file downloads resume from the end of the partial TS.
+func getVideoTs(ctx context.Context, VidPathTs, manBaseUrl, mediaUrl, query string, segPlaylist *SegPlaylist, isLstream bool) error {
+	if isLstream {
+		return downloadLstream(ctx, VidPathTs, manBaseUrl, mediaUrl, query)
+	}
+	var err error
+	for attempt := 1; attempt <= maxRetries; attempt++ {
+		err = downloadVideo(ctx, VidPathTs, manBaseUrl+segPlaylist.SegUrls[0])
+		if err == nil || attempt == maxRetries || ctx.Err() != nil {
+			break
+		}
+		handleErr(fmt.Sprintf("Video download failed, retrying (%d of %d).", attempt, maxRetries-1), err, false)
+	}
+	return err
+}
+
+func extractExistingAudio(ctx context.Context, vidPath string, meta *nugs.AlbArtResp, cfg *Config) error {
+	dur, err := getDuration(ctx, vidPath, cfg.FfmpegNameStr)
+	if err != nil {
+		fmt.Println("Failed to get MP4 duration.")
+		return err
+	}
+	chapters := cleanChapters(meta.VideoChapters, dur)
+	if len(chapters) == 0 {
+		fmt.Println("Video has no usable chapters.")
+		return nil
+	}
+	return extractChapAudio(ctx, vidPath, meta, chapters, cfg)
+}
+
+func parsePerfDate(meta *nugs.AlbArtResp) (time.Time, bool) {
+	for _, dateStr := range []string{meta.PerformanceDate, meta.PerformanceDateShortYearFirst} {
+		for _, _layout := range perfDateLayouts {
+			parsed, err := time.Parse(_layout, strings.TrimSpace(dateStr))
+			if err == nil {
+				return parsed, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// The API gives some image paths relative to imgBase, with or without a leading slash.
+func resolveImgUrl(imgUrl string) string {
+	imgUrl = strings.TrimSpace(imgUrl)
+	switch {
+	case imgUrl == "":
+		return ""
+	case strings.HasPrefix(imgUrl, "//"):
+		return "https:" + imgUrl
+	case strings.HasPrefix(imgUrl, "http://"), strings.HasPrefix(imgUrl, "https://"):
+		return imgUrl
+	}
+	return imgBase + "/" + strings.TrimPrefix(imgUrl, "/")
+}
+
+func downloadImage(ctx context.Context, imgPath, imgUrl string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imgUrl, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("User-Agent", nugs.UserAgent)
+	do, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer do.Body.Close()
+	if do.StatusCode != http.StatusOK {
+		return errors.New(do.Status)
+	}
+	f, err := os.OpenFile(imgPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, do.Body)
+	return err
+}
+
+func getImgExt(imgUrl string) string {
+	var ext string
+	u, err := url.Parse(imgUrl)
+	if err == nil {
+		ext = strings.ToLower(filepath.Ext(u.Path))
+	}
+	if ext == "" {
+		return ".jpg"
+	}
+	return ext
+}
+
+func getArtworks(meta *nugs.AlbArtResp) []*Artwork {
+	var (
+		artworks  []*Artwork
+		discTotal int
+	)
+	for _, art := range meta.CdArtWorkList {
+		if art.DiscNumber > discTotal {
+			discTotal = art.DiscNumber
+		}
+	}
+	for _, art := range meta.CdArtWorkList {
+		name := strings.TrimSpace(art.ArtWorkTypeStr)
+		if name == "" {
+			name = "Artwork " + strconv.Itoa(art.ArtWorkType)
+		}
+		if discTotal > 1 {
+			name = fmt.Sprintf("Disc %d - %s", art.DiscNumber, name)
+		}
+		artworks = append(artworks, &Artwork{Name: name, URL: resolveImgUrl(art.ArtWorkPath)})
+	}
+	for picNum, pic := range meta.Pics {
+		name := strings.TrimSpace(pic.Caption)
+		if name == "" {
+			name = fmt.Sprintf("Picture %02d", picNum+1)
+		}
+		artworks = append(artworks, &Artwork{Name: name, URL: resolveImgUrl(pic.URL)})
+	}
+	return artworks
+}
+
+// Images are deduped by URL hash, which also tells apart different images with the same name.
+func downloadArtwork(ctx context.Context, artPath string, meta *nugs.AlbArtResp) error {
+	artworks := getArtworks(meta)
+	if len(artworks) == 0 {
+		fmt.Println("No artwork available.")
+		return nil
+	}
+	err := makeDirs(artPath)
 	if err != nil {
 		return err
 	}
-	req.Header.Add("Range", fmt.Sprintf("bytes=%d-", startByte))
-	do, err := client.Do(req)
+	seenHashes := map[string]bool{}
+	usedNames := map[string]bool{}
+	for _, art := range artworks {
+		if art.URL == "" {
+			fmt.Println("No usable image URL for " + art.Name + ", skipped.")
+			continue
+		}
+		sum := sha256.Sum256([]byte(art.URL))
+		urlHash := hex.EncodeToString(sum[:])[:8]
+		if seenHashes[urlHash] {
+			continue
+		}
+		seenHashes[urlHash] = true
+		name := sanitise(art.Name)
+		if len(name) > 100 {
+			name = name[:100]
+		}
+		if usedNames[strings.ToLower(name)] {
+			name += " (" + urlHash + ")"
+		}
+		usedNames[strings.ToLower(name)] = true
+		imgPath := filepath.Join(artPath, name+getImgExt(art.URL))
+		exists, err := fileExists(imgPath)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		err = downloadImage(ctx, imgPath, art.URL)
+		if err != nil {
+			handleErr("Failed to download "+name+".", err, false)
+			os.Remove(imgPath)
+		}
+	}
+	return nil
+}
+
+func buildNfoPlot(meta *nugs.AlbArtResp, chapters []*Chapter) string {
+	var lines []string
+	var location []string
+	for _, part := range []string{meta.VenueName, meta.VenueCity, meta.VenueState} {
+		if part != "" {
+			location = append(location, part)
+		}
+	}
+	if len(location) > 0 {
+		lines = append(lines, strings.Join(location, ", "))
+	}
+	if meta.PerformanceDateFormatted != "" {
+		lines = append(lines, meta.PerformanceDateFormatted)
+	}
+	if len(chapters) > 0 {
+		lines = append(lines, "")
+		for i, chapter := range chapters {
+			lines = append(lines, fmt.Sprintf(
+				"%d. %s [%s]", i+1, chapter.Title, formatChapTime(chapter.Start, ".")[:8]))
+		}
+	}
+	for _, note := range meta.Notes {
+		note := strings.TrimSpace(note.Note)
+		if note != "" {
+			lines = append(lines, "", note)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Writes <nfoType>.nfo and the poster and fanart images into the video's folder.
+func writeVideoNfo(ctx context.Context, vidFolPath string, meta *nugs.AlbArtResp, chapters []*Chapter, dur int, nfoType string) error {
+	title := strings.TrimRight(meta.ContainerInfo, " ")
+	nfo := &VideoNfo{
+		XMLName: xml.Name{Local: nfoType},
+		Title:   title,
+		Artist:  meta.ArtistName,
+		Album:   title,
+		Plot:    buildNfoPlot(meta, chapters),
+		Studio:  "nugs.net",
+		Runtime: int(math.Round(float64(dur) / 60)),
+		UniqueID: NfoUniqueID{
+			Type:    "nugs",
+			Default: true,
+			Value:   strconv.Itoa(meta.ContainerID),
+		},
+	}
+	if nfoType == "movie" {
+		nfo.Artist, nfo.Album = "", ""
+		nfo.Director = meta.ArtistName
+	}
+	if meta.VenueName != "" {
+		nfo.Tags = append(nfo.Tags, meta.VenueName)
+	}
+	perfDate, ok := parsePerfDate(meta)
+	if ok {
+		nfo.Premiered = perfDate.Format("2006-01-02")
+		nfo.Year = perfDate.Year()
+	}
+	posterUrl := resolveImgUrl(meta.Img.URL)
+	fanartUrl := resolveImgUrl(meta.VodPlayerImage)
+	if posterUrl == "" {
+		fmt.Println("No usable poster URL, skipped.")
+	} else {
+		err := downloadImage(ctx, filepath.Join(vidFolPath, "poster"+getImgExt(posterUrl)), posterUrl)
+		if err != nil {
+			handleErr("Failed to download poster.", err, false)
+		} else {
+			nfo.Thumbs = append(nfo.Thumbs, NfoThumb{Aspect: "poster", Value: posterUrl})
+		}
+	}
+	if fanartUrl == "" {
+		fmt.Println("No usable fanart URL, skipped.")
+	} else {
+		err := downloadImage(ctx, filepath.Join(vidFolPath, "fanart"+getImgExt(fanartUrl)), fanartUrl)
+		if err != nil {
+			handleErr("Failed to download fanart.", err, false)
+		} else {
+			nfo.Fanart = &NfoFanart{Thumbs: []NfoThumb{{Value: fanartUrl}}}
+		}
+	}
+	data, err := xml.MarshalIndent(nfo, "", "  ")
 	if err != nil {
 		return err
 	}
-	defer do.Body.Close()
-	if do.StatusCode != http.StatusOK && do.StatusCode != http.StatusPartialContent {
-		return errors.New(do.Status)
+	data = append([]byte(xml.Header), data...)
+	return os.WriteFile(filepath.Join(vidFolPath, nfoType+".nfo"), data, 0755)
+}
+
+func paidLstream(ctx context.Context, query, uguID string, cfg *Config, streamParams *nugs.StreamParams) error {
+    q, err := url.ParseQuery(query)
+	if err != nil {
+		return err
+	}
+	showId := q["showID"][0]
+	if showId == "" {
+		return errors.New("url didn't contain a show id parameter")
 	}
+	err = video(ctx, showId, uguID, cfg, streamParams, nil, true)
+	return err
+}
 
-	if startByte > 0 {
-		fmt.Printf("TS already exists locally, resuming from byte %d...\n", startByte)
-		startByte = 0
+func parseEventTime(dateStr string, utcOffset int) (time.Time, error) {
+	// UTCoffset is in whole hours, e.g. -4 for EDT.
+	loc := time.FixedZone("", utcOffset*3600)
+	for _, _layout := range eventLayouts {
+		parsed, err := time.ParseInLocation(_layout, dateStr, loc)
+		if err == nil {
+			return parsed, nil
+		}
 	}
+	return time.Time{}, errors.New("unsupported event date format: " + dateStr)
+}
 
-	totalBytes := do.ContentLength
-	counter := &WriteCounter{
-		Total:     totalBytes,
-		TotalStr:  humanize.Bytes(uint64(totalBytes)),
-		StartTime: time.Now().UnixMilli(),
-		Downloaded: startByte,
+func getLstreamTimes(meta *nugs.AlbArtResp) (time.Time, time.Time, error) {
+	var (
+		startStr  string
+		endStr    string
+		utcOffset int
+	)
+	for _, product := range meta.ProductFormatList {
+		if product.FormatStr == "LIVE HD VIDEO" {
+			startStr, _ = product.LiveEvent.EventStartDateStr.(string)
+			endStr, _ = product.LiveEvent.EventEndDateStr.(string)
+			utcOffset = product.LiveEvent.UTCoffset
+			break
+		}
+	}
+	if startStr == "" {
+		for _, product := range meta.Products {
+			if product.FormatStr == "LIVE HD VIDEO" {
+				startStr = product.LiveEventInfo.EventStartDateStr
+				endStr = product.LiveEventInfo.EventEndDateStr
+				utcOffset = product.LiveEventInfo.UTCoffset
+				break
+			}
+		}
+	}
+	if startStr == "" {
+		return time.Time{}, time.Time{}, errors.New("livestream has no event start date")
+	}
+	start, err := parseEventTime(startStr, utcOffset)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	// No end date isn't fatal, we'll just keep retrying.
+	end, _ := parseEventTime(endStr, utcOffset)
+	return start, end, nil
+}
+
+// Returns the context's error if it's cancelled before d is up.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func waitUntil(ctx context.Context, start time.Time) error {
+	for {
+		remaining := time.Until(start)
+		if remaining <= 0 {
+			break
+		}
+		fmt.Printf("\rStarting in %s... ", remaining.Round(time.Second))
+		if remaining > time.Second {
+			remaining = time.Second
+		}
+		err := sleepCtx(ctx, remaining)
+		if err != nil {
+			fmt.Println("")
+			return err
+		}
 	}
-	_, err = io.Copy(f, io.TeeReader(do.Body, counter))
 	fmt.Println("")
-	return err
+	return nil
 }
 
-func downloadLstream(videoPath, baseUrl string, segUrls []string) error {
-	f, err := os.OpenFile(videoPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+func scheduleLstream(ctx context.Context, videoID string, cfg *Config, streamParams *nugs.StreamParams) error {
+	m, err := api.GetAlbumMeta(ctx, videoID)
 	if err != nil {
+		fmt.Println("Failed to get metadata.")
 		return err
 	}
-	defer f.Close()
-	segTotal := len(segUrls)
-	for segNum, segUrl := range segUrls {
-		segNum++
-		fmt.Printf("\rSegment %d of %d.", segNum, segTotal)
-		if err != nil {
+	meta := m.Response
+	start, end, err := getLstreamTimes(meta)
+	if err != nil {
+		fmt.Println("Failed to get livestream event times.")
+		return err
+	}
+	fmt.Println(meta.ArtistName + " - " + strings.TrimRight(meta.ContainerInfo, " "))
+	fmt.Println("Event starts at", start.Local().Format(scheduleLayout))
+	err = waitUntil(ctx, start)
+	if err != nil {
+		return err
+	}
+	retryDelay := time.Duration(cfg.ScheduleRetry) * time.Second
+	for {
+		err = video(ctx, videoID, "", cfg, streamParams, meta, true)
+		if err == nil {
+			return nil
+		}
+		if !end.IsZero() && time.Now().After(end) {
+			fmt.Println("Event has ended.")
 			return err
 		}
-		req, err := http.NewRequest(http.MethodGet, baseUrl+segUrl, nil)
+		handleErr("Livestream unavailable, retrying in "+retryDelay.String()+".", err, false)
+		err = sleepCtx(ctx, retryDelay)
 		if err != nil {
 			return err
 		}
-		do, err := client.Do(req)
+		// Re-fetch as the products can change once the event's live.
+		m, err = api.GetAlbumMeta(ctx, videoID)
+		if err == nil {
+			meta = m.Response
+		}
+	}
+}
+
+func estimateSize(kbps, secs int) string {
+	if kbps == 0 || secs == 0 {
+		return "unknown"
+	}
+	return "~" + humanize.Bytes(uint64(kbps)*1000/8*uint64(secs))
+}
+
+func getQualKbps(qual *Quality) int {
+	if qual.Format == 6 {
+		kbps, _ := strconv.Atoi(strings.SplitN(qual.Specs, " ", 2)[0])
+		return kbps
+	}
+	return estBitrates[qual.Format]
+}
+
+func listAudioFormats(ctx context.Context, meta *nugs.AlbArtResp, tracks []nugs.Track, streamParams *nugs.StreamParams) error {
+	// All tracks of a container share the same formats, so only probe the first one.
+	quals, err := getTrackQuals(ctx, tracks[0].TrackID, streamParams)
+	if err != nil {
+		return err
+	}
+	if checkIfHlsOnly(quals) {
+		quals = quals[:1]
+		err = parseHlsMaster(ctx, quals[0])
 		if err != nil {
 			return err
 		}
-		if do.StatusCode != http.StatusOK {
-			do.Body.Close()
-			return errors.New(do.Status)
+	}
+	sort.Slice(quals, func(x, y int) bool {
+		return quals[x].Format < quals[y].Format
+	})
+	fmt.Printf("Audio, %d tracks, %s:\n", len(tracks), meta.HhmmssTotalRunningTime)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FORMAT\tSPECS\tEXT\tEST. SIZE")
+	for _, qual := range quals {
+		size := estimateSize(getQualKbps(qual), meta.TotalContainerRunningTime)
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", qual.Format, qual.Specs, qual.Extension, size)
+	}
+	return w.Flush()
+}
+
+func listVideoFormats(ctx context.Context, videoID, uguID string, meta *nugs.AlbArtResp, streamParams *nugs.StreamParams, isLstream bool) error {
+	manifestUrl, err := getVideoManifestUrl(ctx, videoID, uguID, meta, streamParams, isLstream)
+	if err != nil {
+		return err
+	}
+	master, err := getMasterPlaylist(ctx, manifestUrl)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Video:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VARIANT\tRESOLUTION\tFPS\tBITRATE\tCODECS\tEST. SIZE")
+	// Numbered in the same order chooseVariant uses for --variant.
+	for i, variant := range master.Variants {
+		kbps := int(variant.Bandwidth / 1000)
+		fmt.Fprintf(w, "%d\t%s\t%.3f\t%d Kbps\t%s\t%s\n", i+1, variant.Resolution,
+			variant.FrameRate, kbps, variant.Codecs, estimateSize(kbps, meta.TotalContainerRunningTime))
+	}
+	return w.Flush()
+}
+
+func listFormats(ctx context.Context, itemID string, kind MediaKind, cfg *Config, streamParams *nugs.StreamParams) error {
+	var isLstream bool
+	switch kind {
+	case KindRelease, KindVideo:
+	case KindLivestream, KindWebcast:
+		isLstream = true
+	default:
+		return errors.New("listing formats is only supported for release, video and livestream URLs")
+	}
+	m, err := api.GetAlbumMeta(ctx, itemID)
+	if err != nil {
+		fmt.Println("Failed to get metadata.")
+		return err
+	}
+	meta := m.Response
+	fmt.Println(meta.ArtistName + " - " + strings.TrimRight(meta.ContainerInfo, " "))
+	if len(meta.Tracks) > 0 && kind == KindRelease {
+		err = listAudioFormats(ctx, meta, meta.Tracks, streamParams)
+		if err != nil {
+			fmt.Println("Failed to get audio formats.")
+			return err
 		}
-		_, err = io.Copy(f, do.Body)
-		do.Body.Close()
+	}
+	var skuID int
+	if isLstream {
+		skuID = getLstreamSku(meta.ProductFormatList)
+	} else {
+		skuID = getVideoSku(meta.Products)
+	}
+	if skuID != 0 && !cfg.SkipVideos {
+		err = listVideoFormats(ctx, itemID, "", meta, streamParams, isLstream)
 		if err != nil {
+			fmt.Println("Failed to get video formats.")
 			return err
 		}
 	}
-	fmt.Println("")
-	return err
+	return nil
 }
 
-func extractDuration(errStr string) string {
-	regex := regexp.MustCompile(durRegex)
-	match := regex.FindStringSubmatch(errStr)
-	if match != nil {
-		return match[1]
+func parseSelection(selection string, total int) ([]int, error) {
+	var nums []int
+	selection = strings.TrimSpace(selection)
+	if strings.EqualFold(selection, "all") {
+		for i := 1; i <= total; i++ {
+			nums = append(nums, i)
+		}
+		return nums, nil
 	}
-	return ""
+	for _, part := range strings.Split(selection, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		bounds := strings.SplitN(part, "-", 2)
+		start, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			return nil, errors.New("invalid selection: " + part)
+		}
+		end := start
+		if len(bounds) == 2 {
+			end, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+			if err != nil {
+				return nil, errors.New("invalid selection: " + part)
+			}
+		}
+		if start < 1 || end > total || start > end {
+			return nil, errors.New("selection out of range: " + part)
+		}
+		for i := start; i <= end; i++ {
+			nums = append(nums, i)
+		}
+	}
+	return nums, nil
 }
 
-func parseDuration(dur string) (int, error) {
-	dur = strings.Replace(dur, ":", "h", 1)
-	dur = strings.Replace(dur, ":", "m", 1)
-	dur = strings.Replace(dur, ".", "s", 1)
-	dur += "ms"
-	d, err := time.ParseDuration(dur)
+func search(ctx context.Context, cfg *Config) ([]string, error) {
+	var results []*ListResult
+	searchMeta, err := api.Search(ctx, cfg.Search)
 	if err != nil {
-		return 0, err
+		fmt.Println("Failed to search catalog.")
+		return nil, err
 	}
-	rounded := math.Round(d.Seconds())
-	return int(rounded), nil
+	resp := searchMeta.Response
+	searchType := cfg.SearchType
+	if searchType == "all" || searchType == "artists" {
+		for _, artist := range resp.Artists {
+			results = append(results, &ListResult{
+				Kind:  "Artists",
+				Title: artist.ArtistName,
+				ID:    artist.ArtistID,
+				URL:   fmt.Sprintf("%sartist/%d", playerUrl, artist.ArtistID),
+			})
+		}
+	}
+	if searchType == "all" || searchType == "shows" {
+		for _, container := range resp.Containers {
+			if cfg.Filter != nil && !matchesFilter(container, cfg.Filter) {
+				continue
+			}
+			results = append(results, &ListResult{
+				Kind:  "Shows",
+				Title: container.ArtistName + " - " + strings.TrimRight(container.ContainerInfo, " "),
+				ID:    container.ContainerID,
+				URL:   fmt.Sprintf("%srelease/%d", playerUrl, container.ContainerID),
+			})
+		}
+	}
+	if searchType == "all" || searchType == "songs" {
+		for _, song := range resp.Songs {
+			results = append(results, &ListResult{
+				Kind:  "Songs",
+				Title: song.ArtistName + " - " + song.SongTitle,
+				ID:    song.ContainerID,
+				URL:   fmt.Sprintf("%srelease/%d", playerUrl, song.ContainerID),
+			})
+		}
+	}
+	if len(results) == 0 {
+		fmt.Println("No results.")
+		return nil, nil
+	}
+	printResults(results)
+	if !cfg.Queue {
+		return nil, nil
+	}
+	return selectResults(results)
 }
 
-// Horrible, but best way without ffprobe.
-// My native Go duration calculation's too slow. Is there a way without having to iterate over all the packets?
-func getDuration(tsPath, ffmpegNameStr string) (int, error) {
-	var errBuffer bytes.Buffer
-	args := []string{"-hide_banner", "-i", tsPath}
-	cmd := exec.Command(ffmpegNameStr, args...)
-	cmd.Stderr = &errBuffer
-	// Return code's always 1 as we're not providing any output files.
-	err := cmd.Run()
-	if err.Error() != "exit status 1" {
-		return 0, err
+func printResults(results []*ListResult) {
+	var lastKind string
+	for i, result := range results {
+		if result.Kind != lastKind {
+			fmt.Println(result.Kind + ":")
+			lastKind = result.Kind
+		}
+		fmt.Printf("  %d. %s [%d] %s\n", i+1, result.Title, result.ID, result.URL)
 	}
-	errStr := errBuffer.String()
-	ok := strings.HasSuffix(
-		strings.TrimSpace(errStr), "At least one output file must be specified")
-	if !ok {
-		errString := fmt.Sprintf("%s\n%s", err, errStr)
-		return 0, errors.New(errString)
+}
+
+func getResultUrls(results []*ListResult, nums []int) []string {
+	var urls []string
+	for _, num := range nums {
+		_url := results[num-1].URL
+		if !contains(urls, _url) {
+			urls = append(urls, _url)
+		}
 	}
-	dur := extractDuration(errStr)
-	if dur == "" {
-		return 0, errors.New("No regex match.")
+	return urls
+}
+
+func selectResults(results []*ListResult) ([]string, error) {
+	fmt.Print("Numbers to download, e.g. 1,3-5 or all: ")
+	reader := bufio.NewReader(os.Stdin)
+	selection, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
 	}
-	durSecs, err := parseDuration(dur)
+	nums, err := parseSelection(selection, len(results))
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return durSecs, nil
+	return getResultUrls(results, nums), nil
 }
 
-func getNextChapStart(chapters []interface{}, idx int) float64 {
-	for i, chapter := range chapters {
-		if i == idx {
-			m := chapter.(map[string]interface{})
-			return m["chapterSeconds"].(float64)
+func getStashUrl(item *nugs.StashItem) string {
+	if item.ShowID == 0 {
+		return fmt.Sprintf("%srelease/%d", playerUrl, item.ContainerID)
+	}
+	query := url.Values{}
+	query.Set("skuID", strconv.Itoa(item.SkuID))
+	query.Set("showID", strconv.Itoa(item.ShowID))
+	return "https://www.nugs.net/on/demandware.store/Sites-NugsNet-Site/default/Stash-QueueVideo?" +
+		query.Encode()
+}
+
+// The user APIs are keyed by email, which a token login may not carry.
+var errNoUser = errors.New("user APIs need an email, set email in the config")
+
+func library(ctx context.Context, cfg *Config, legacyToken string) ([]string, error) {
+	if cfg.User == "" {
+		return nil, errNoUser
+	}
+	var results []*ListResult
+	if contains(cfg.Library, "playlists") {
+		plists, err := api.GetUserPlists(ctx, cfg.User, legacyToken)
+		if err != nil {
+			fmt.Println("Failed to get user playlists.")
+			return nil, err
+		}
+		for _, plist := range plists.Response.Items {
+			results = append(results, &ListResult{
+				Kind:  "Playlists",
+				Title: fmt.Sprintf("%s (%d tracks)", plist.PlayListName, plist.NumTracks),
+				ID:    plist.ID,
+				URL:   fmt.Sprintf("%slibrary/playlist/%d", playerUrl, plist.ID),
+			})
 		}
 	}
-	return 0
-}
-
-
-func writeChapsFile(chapters []interface{}, dur int) error {
-	f, err := os.OpenFile(chapsFileFname, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
-	if err != nil {
-		return err
+	if contains(cfg.Library, "favorites") {
+		favs, err := api.GetUserFavs(ctx, cfg.User, legacyToken)
+		if err != nil {
+			fmt.Println("Failed to get favorites.")
+			return nil, err
+		}
+		for _, container := range favs.Response.Containers {
+			if cfg.Filter != nil && !matchesFilter(container, cfg.Filter) {
+				continue
+			}
+			results = append(results, &ListResult{
+				Kind:  "Favorites",
+				Title: container.ArtistName + " - " + strings.TrimRight(container.ContainerInfo, " "),
+				ID:    container.ContainerID,
+				URL:   fmt.Sprintf("%srelease/%d", playerUrl, container.ContainerID),
+			})
+		}
+	}
+	if contains(cfg.Library, "stash") {
+		stash, err := api.GetUserStash(ctx, cfg.User, legacyToken)
+		if err != nil {
+			fmt.Println("Failed to get stash.")
+			return nil, err
+		}
+		for _, item := range stash.Response.Items {
+			if cfg.Filter != nil && !matchesFilter(&item.AlbArtResp, cfg.Filter) {
+				continue
+			}
+			id := item.ContainerID
+			if item.ShowID != 0 {
+				id = item.ShowID
+			}
+			results = append(results, &ListResult{
+				Kind:  "Stash",
+				Title: item.ArtistName + " - " + strings.TrimRight(item.ContainerInfo, " "),
+				ID:    id,
+				URL:   getStashUrl(item),
+			})
+		}
+	}
+	if len(results) == 0 {
+		fmt.Println("Nothing in library.")
+		return nil, nil
+	}
+	printResults(results)
+	if cfg.Queue {
+		return selectResults(results)
 	}
-	defer f.Close()
-	_, err = f.WriteString(";FFMETADATA1\n")
-	if err != nil {
-		return err
+	nums := make([]int, len(results))
+	for i := range nums {
+		nums[i] = i + 1
 	}
-	chaptersCount := len(chapters)
-
-	var nextChapStart float64
-
-	for i, chapter := range chapters {
-		i++
-		isLast := i == chaptersCount
+	return getResultUrls(results, nums), nil
+}
 
-		// casting to struct won't work.
-		m := chapter.(map[string]interface{})
-		start := m["chapterSeconds"].(float64)
+func getExportRows(meta *nugs.AlbArtResp) []*ExportRow {
+	notes := getNotes(meta)
+	base := ExportRow{
+		ContainerID:          meta.ContainerID,
+		ArtistName:           meta.ArtistName,
+		ContainerInfo:        strings.TrimRight(meta.ContainerInfo, " "),
+		ContainerType:        meta.ContainerTypeStr,
+		PerformanceDate:      meta.PerformanceDate,
+		VenueName:            meta.VenueName,
+		VenueCity:            meta.VenueCity,
+		VenueState:           meta.VenueState,
+		ContainerRunningTime: meta.TotalContainerRunningTime,
+		Notes:                strings.Join(notes, "\n"),
+	}
+	// Still record shows without tracks, e.g. video-only ones.
+	if len(meta.Tracks) == 0 {
+		return []*ExportRow{&base}
+	}
+	var rows []*ExportRow
+	for _, track := range meta.Tracks {
+		row := base
+		row.TrackID = track.TrackID
+		row.SongID = track.SongID
+		row.DiscNum = track.DiscNum
+		row.SetNum = track.SetNum
+		row.TrackNum = track.TrackNum
+		row.SongTitle = track.SongTitle
+		row.RunningTime = track.TotalRunningTime
+		rows = append(rows, &row)
+	}
+	return rows
+}
 
-		if !isLast {
-			nextChapStart = getNextChapStart(chapters, i)
-			if nextChapStart <= start {
-				continue
-			}
-		}
+func getExportRecord(row *ExportRow) []string {
+	return []string{
+		strconv.Itoa(row.ContainerID), row.ArtistName, row.ContainerInfo, row.ContainerType,
+		row.PerformanceDate, row.VenueName, row.VenueCity, row.VenueState,
+		strconv.Itoa(row.ContainerRunningTime), row.Notes, strconv.Itoa(row.TrackID),
+		strconv.Itoa(row.SongID), strconv.Itoa(row.DiscNum), strconv.Itoa(row.SetNum),
+		strconv.Itoa(row.TrackNum), row.SongTitle, strconv.Itoa(row.RunningTime),
+	}
+}
 
-		_, err := f.WriteString("\n[CHAPTER]\n")
+func getItemExportRows(ctx context.Context, ref *MediaRef, legacyToken string, cfg *Config) ([]*ExportRow, error) {
+	switch ref.Kind {
+	case KindRelease, KindVideo, KindLivestream, KindWebcast:
+		meta, err := api.GetAlbumMeta(ctx, ref.ID)
 		if err != nil {
-			return err
+			fmt.Println("Failed to get metadata.")
+			return nil, err
 		}
-		_, err = f.WriteString("TIMEBASE=1/1\n")
+		fmt.Println(meta.Response.ArtistName + " - " + strings.TrimRight(meta.Response.ContainerInfo, " "))
+		return getExportRows(meta.Response), nil
+	case KindUserPlaylist, KindCatPlaylist:
+		meta, err := api.GetPlistMeta(ctx, ref.ID, cfg.User, legacyToken, ref.Kind == KindCatPlaylist)
 		if err != nil {
-			return err
+			fmt.Println("Failed to get playlist metadata.")
+			return nil, err
 		}
-
-		startLine := fmt.Sprintf("START=%d\n", int(math.Round(start)))
-		_, err = f.WriteString(startLine)
+		fmt.Println(meta.Response.PlayListName)
+		var rows []*ExportRow
+		for _, item := range meta.Response.Items {
+			container := item.PlaylistContainer
+			rows = append(rows, &ExportRow{
+				ContainerID:          container.ContainerID,
+				ArtistName:           container.ArtistName,
+				ContainerInfo:        strings.TrimRight(container.ContainerInfo, " "),
+				PerformanceDate:      container.PerformanceDate,
+				VenueName:            container.VenueName,
+				VenueCity:            container.VenueCity,
+				VenueState:           container.VenueState,
+				ContainerRunningTime: container.TotalRunningTime,
+				TrackID:              item.Track.TrackID,
+				SongID:               item.Track.SongID,
+				DiscNum:              item.Track.DiscNum,
+				SetNum:               item.Track.SetNum,
+				TrackNum:             item.Track.TrackNum,
+				SongTitle:            item.Track.SongTitle,
+				RunningTime:          item.Track.TotalRunningTime,
+			})
+		}
+		return rows, nil
+	case KindArtist:
+		meta, err := api.GetArtistMeta(ctx, ref.ID, nil)
 		if err != nil {
-			return err
+			fmt.Println("Failed to get artist metadata.")
+			return nil, err
 		}
-		if isLast {
-			endLine := fmt.Sprintf("END=%d\n", dur)
-			_, err = f.WriteString(endLine)
-			if err != nil {
-				return err
-			}
+		var containers []*nugs.AlbArtResp
+		if cfg.Filter != nil {
+			containers = filterContainers(meta, cfg.Filter)
 		} else {
-			endLine := fmt.Sprintf("END=%d\n", int(math.Round(nextChapStart)-1))
-			_, err = f.WriteString(endLine)
-			if err != nil {
-				return err
+			for _, _meta := range meta {
+				containers = append(containers, _meta.Response.Containers...)
 			}
 		}
-		_, err = f.WriteString("TITLE=" + m["chaptername"].(string) + "\n")
-		if err != nil {
-			return err
+		var rows []*ExportRow
+		containerTotal := len(containers)
+		for containerNum, container := range containers {
+			fmt.Printf(
+				"Item %d of %d: %s - %s\n", containerNum+1, containerTotal, container.ArtistName,
+				strings.TrimRight(container.ContainerInfo, " "),
+			)
+			// The artist listing doesn't include everything, e.g. notes.
+			albumMeta, err := api.GetAlbumMeta(ctx, strconv.Itoa(container.ContainerID))
+			if err != nil {
+				handleErr("Failed to get metadata.", err, false)
+				continue
+			}
+			rows = append(rows, getExportRows(albumMeta.Response)...)
 		}
+		return rows, nil
 	}
-	return nil
+	return nil, errors.New("exporting isn't supported for this kind of URL")
 }
 
-// There are native MPEG demuxers and MP4 muxers for Go, but they're too slow.
-func tsToMp4(VidPathTs, vidPath, ffmpegNameStr string, chapAvail bool) error {
+func export(ctx context.Context, cfg *Config, legacyToken string) error {
+	f, err := os.Create(cfg.ExportPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
 	var (
-		errBuffer bytes.Buffer
-		args      []string
+		csvWriter *csv.Writer
+		jsonEnc   *json.Encoder
 	)
-	if chapAvail {
-		args = []string{
-			"-hide_banner", "-i", VidPathTs, "-f", "ffmetadata",
-			"-i", chapsFileFname, "-map_metadata", "1", "-c", "copy", vidPath,
+	if cfg.ExportFormat == "csv" {
+		csvWriter = csv.NewWriter(f)
+		err = csvWriter.Write(exportCols)
+		if err != nil {
+			return err
 		}
 	} else {
-		args = []string{"-hide_banner", "-i", VidPathTs, "-c", "copy", vidPath}
+		jsonEnc = json.NewEncoder(f)
 	}
-	cmd := exec.Command(ffmpegNameStr, args...)
-	cmd.Stderr = &errBuffer
-	err := cmd.Run()
-	if err != nil {
-		errString := fmt.Sprintf("%s\n%s", err, errBuffer.String())
-		return errors.New(errString)
+	var rowTotal int
+	itemTotal := len(cfg.Urls)
+	for itemNum, _url := range cfg.Urls {
+		fmt.Printf("Item %d of %d:\n", itemNum+1, itemTotal)
+		ref, err := parseUrl(ctx, _url, true)
+		if err != nil {
+			handleErr("Invalid URL or specifier: "+_url, err, false)
+			continue
+		}
+		rows, err := getItemExportRows(ctx, ref, legacyToken, cfg)
+		if err != nil {
+			handleErr("Item failed.", err, false)
+			continue
+		}
+		for _, row := range rows {
+			if csvWriter != nil {
+				err = csvWriter.Write(getExportRecord(row))
+			} else {
+				err = jsonEnc.Encode(row)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		rowTotal += len(rows)
 	}
-	return nil
-}
-
-func getLstreamContainer(containers []*AlbArtResp) *AlbArtResp {
-	for i := len(containers) - 1; i >= 0; i-- {
-		c := containers[i]
-		if c.AvailabilityTypeStr == "AVAILABLE" && c.ContainerTypeStr == "Show" {
-			return c
+	if csvWriter != nil {
+		csvWriter.Flush()
+		err = csvWriter.Error()
+		if err != nil {
+			return err
 		}
 	}
+	fmt.Printf("Exported %d rows to %s.\n", rowTotal, cfg.ExportPath)
 	return nil
 }
 
-func parseLstreamMeta(_meta *ArtistMeta) *AlbumMeta {
-	meta := getLstreamContainer(_meta.Response.Containers)
-	parsed := &AlbumMeta{
-		Response: &AlbArtResp{
-			ArtistName:        meta.ArtistName,
-			ContainerInfo:     meta.ContainerInfo,
-			ContainerID:       meta.ContainerID,
-			VideoChapters:     meta.VideoChapters,
-			Products:          meta.Products,
-			ProductFormatList: meta.ProductFormatList,
-		},
-	}
-	return parsed
-}
-
-func video(videoID, uguID string, cfg *Config, streamParams *StreamParams, _meta *AlbArtResp, isLstream bool) error {
+func login(ctx context.Context, cfg *Config) (*Session, error) {
 	var (
-		chapsAvail bool
-		skuID int
-		manifestUrl string
-		meta *AlbArtResp
-		err error
+		token string
+		err   error
 	)
-
-	if _meta != nil {
-		meta = _meta
-	} else {
-		m, err := getAlbumMeta(videoID)
+	if cfg.Token == "" {
+		token, err = api.Auth(ctx, cfg.Email, cfg.Password)
 		if err != nil {
-			fmt.Println("Failed to get metadata.")
-			return err
+			fmt.Println("Failed to auth.")
+			return nil, err
 		}
-		meta = m.Response
-	}
-
-	if !cfg.SkipChapters {
-		chapsAvail = !reflect.ValueOf(meta.VideoChapters).IsZero()
-	}
-	
-	videoFname := meta.ArtistName + " - " + strings.TrimRight(meta.ContainerInfo, " ")
-	fmt.Println(videoFname)
-	if len(videoFname) > 110 {
-		videoFname = videoFname[:110]
-		fmt.Println(
-			"Video filename was chopped because it exceeds 120 characters.")
-	}
-	if isLstream {
-		skuID = getLstreamSku(meta.ProductFormatList)
-	} else {
-		skuID = getVideoSku(meta.Products)
-	}
-	if skuID == 0 {
-		return errors.New("no video available")
-	}
-	if uguID == "" {
-		manifestUrl, err = getStreamMeta(
-			meta.ContainerID, skuID, 0, streamParams)
 	} else {
-		manifestUrl, err = getPurchasedManUrl(skuID, videoID, streamParams.UserID, uguID)
+		token = cfg.Token
 	}
-
+	userInfo, err := api.GetUserInfo(ctx, token)
 	if err != nil {
-		fmt.Println("Failed to get video file metadata.")
-		return err
-	} else if manifestUrl == "" {
-		return errors.New("the api didn't return a video manifest url")
+		fmt.Println("Failed to get user info.")
+		return nil, err
 	}
-	variant, retRes, err := chooseVariant(manifestUrl, cfg.WantRes)
+	subInfo, err := api.GetSubInfo(ctx, token)
 	if err != nil {
-		fmt.Println("Failed to get video master manifest.")
-		return err
+		fmt.Println("Failed to get subcription info.")
+		return nil, err
 	}
-	vidPathNoExt := filepath.Join(cfg.OutPath, sanitise(videoFname+"_"+retRes))
-	VidPathTs := vidPathNoExt + ".ts"
-	vidPath := vidPathNoExt + ".mp4"
-	exists, err := fileExists(vidPath)
+	payload, err := nugs.ParseToken(token)
 	if err != nil {
-		fmt.Println("Failed to check if video already exists locally.")
-		return err
+		fmt.Println("Failed to extract legacy token.")
+		return nil, err
 	}
-	if exists {
-		fmt.Println("Video already exists locally.")
-		return nil
+	// The legacy user APIs want the email, which token logins only have in the token.
+	cfg.User = cfg.Email
+	if cfg.User == "" {
+		cfg.User = payload.Email
 	}
-	manBaseUrl, query, err := getManifestBase(manifestUrl)
-	if err != nil {
-		fmt.Println("Failed to get video manifest base URL.")
-		return err
+	planDesc, isPromo := getPlan(subInfo)
+	if !subInfo.IsContentAccessible {
+		planDesc = "no active subscription"
 	}
+	sess := &Session{
+		Token:        token,
+		StreamParams: parseStreamParams(userInfo.Sub, subInfo, isPromo),
+		LegacyToken:  payload.LegacyToken,
+		UguID:        payload.LegacyUguid,
+		PlanDesc:     planDesc,
+	}
+	return sess, nil
+}
 
-	segUrls, err := getSegUrls(manBaseUrl+variant.URI, query)
+func getTokenExpiry(tokenStr string) (time.Time, error) {
+	payload, err := nugs.ParseToken(tokenStr)
 	if err != nil {
-		fmt.Println("Failed to get video segment URLs.")
-		return err
+		return time.Time{}, err
 	}
+	return time.Unix(int64(payload.Exp), 0), nil
+}
 
-	// Player album page videos aren't always only the first seg for the entire vid.
-	isLstream = segUrls[0] != segUrls[1]
-
-	if !isLstream {
-		fmt.Printf("%.3f FPS, ", variant.FrameRate)
-	}
-	fmt.Printf("%d Kbps, %s (%s)\n",
-		variant.Bandwidth/1000, retRes, variant.Resolution)
-	if isLstream {
-		err = downloadLstream(VidPathTs, manBaseUrl, segUrls)
-	} else {
-		err = downloadVideo(VidPathTs, manBaseUrl+segUrls[0])
-	}
+func newWatchLogger(logPath string) (*log.Logger, *os.File, error) {
+	f, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0755)
 	if err != nil {
-		fmt.Println("Failed to download video segments.")
-		return err
+		return nil, nil, err
 	}
-	if chapsAvail {
-		dur, err := getDuration(VidPathTs, cfg.FfmpegNameStr)
-		if err != nil {
-			fmt.Println("Failed to get TS duration.")
-			return err
+	logger := log.New(io.MultiWriter(os.Stdout, f), "", log.LstdFlags)
+	return logger, f, nil
+}
+
+// Stops early and returns the error if the session is rejected or ctx is cancelled.
+func pollArtists(ctx context.Context, cfg *Config, sess *Session, logger *log.Logger) error {
+	for _, artistId := range cfg.FollowedArtists {
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
-		err = writeChapsFile(meta.VideoChapters, dur)
-		if err != nil {
-			fmt.Println("Failed to write chapters file.")
+		logger.Println("Checking artist", artistId)
+		err := syncArtist(ctx, artistId, cfg, sess.StreamParams, logger)
+		if errors.Is(err, nugs.ErrUnauthorized) {
 			return err
 		}
-	}
-	fmt.Println("Putting into MP4 container...")
-	err = tsToMp4(VidPathTs, vidPath, cfg.FfmpegNameStr, chapsAvail)
-	if err != nil {
-		fmt.Println("Failed to put TS into MP4 container.")
-		return err
-	}
-	if chapsAvail {
-		err = os.Remove(chapsFileFname)
 		if err != nil {
-			fmt.Println("Failed to delete chapters file.")
+			logger.Printf("Artist %s failed: %s\n", artistId, err)
 		}
 	}
-	err = os.Remove(VidPathTs)
-	if err != nil {
-		fmt.Println("Failed to delete TS.")
-	}
 	return nil
 }
 
-func resolveCatPlistId(plistUrl string) (string, error) {
-	req, err := client.Get(plistUrl)
-	if err != nil {
-		return "", err
-	}
-	req.Body.Close()
-	if req.StatusCode != http.StatusOK {
-		return "", errors.New(req.Status)
-	}
-	location := req.Request.URL.String()
-	u, err := url.Parse(location)
-	if err != nil {
-		return "", err
-	}
-	q, err := url.ParseQuery(u.RawQuery)
-	if err != nil {
-		return "", err
+// Signs in again if the token has expired or was rejected.
+// That needs the config's email and password, a token on its own can't be renewed.
+func refreshSession(ctx context.Context, cfg *Config, sess *Session, rejected bool) (*Session, error) {
+	if !rejected {
+		expiry, err := getTokenExpiry(sess.Token)
+		if err != nil || time.Now().Before(expiry) {
+			return sess, nil
+		}
 	}
-	resolvedId := q.Get("plGUID")
-	if resolvedId == "" {
-		return "", errors.New("not a catalog playlist")
+	if cfg.Email == "" || cfg.Password == "" {
+		return nil, errors.New(
+			"token has expired or was rejected, replace it or add an email and password to the config")
 	}
-	return resolvedId, nil
+	// Make login use the credentials rather than the dead token.
+	cfg.Token = ""
+	return login(ctx, cfg)
 }
 
-func catalogPlist(_plistId, legacyToken string, cfg *Config, streamParams *StreamParams) error {
-	plistId, err := resolveCatPlistId(_plistId)
-	if err != nil {
-		fmt.Println("Failed to resolve playlist ID.")
-		return err
+func watch(ctx context.Context, cfg *Config, sess *Session) error {
+	if len(cfg.FollowedArtists) == 0 {
+		return errors.New("no followed artists in config")
 	}
-	err = playlist(plistId, legacyToken, cfg, streamParams, true)
-	return err
-}
-
-func paidLstream(query, uguID string, cfg *Config, streamParams *StreamParams) error {
-    q, err := url.ParseQuery(query)
+	logger, f, err := newWatchLogger(cfg.WatchLogPath)
 	if err != nil {
+		fmt.Println("Failed to open watch log.")
 		return err
 	}
-	showId := q["showID"][0]
-	if showId == "" {
-		return errors.New("url didn't contain a show id parameter")
+	defer f.Close()
+	interval := time.Duration(cfg.PollInterval) * time.Minute
+	logger.Printf("Watching %d artists every %s.\n", len(cfg.FollowedArtists), interval)
+	var rejected bool
+	for {
+		sess, err = refreshSession(ctx, cfg, sess, rejected)
+		if err != nil {
+			logger.Println("Failed to sign in again:", err)
+			return err
+		}
+		err = pollArtists(ctx, cfg, sess, logger)
+		if errors.Is(err, nugs.ErrUnauthorized) {
+			// A fresh session being rejected too won't be fixed by signing in again.
+			if rejected {
+				logger.Println("Session was rejected again after signing in:", err)
+				return err
+			}
+			logger.Println("Session was rejected, signing in again:", err)
+			rejected = true
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		rejected = false
+		logger.Println("Next poll at", time.Now().Add(interval).Format(scheduleLayout))
+		err = sleepCtx(ctx, interval)
+		if err != nil {
+			return err
+		}
 	}
-	err = video(showId, uguID, cfg, streamParams, nil, true)
-	return err
 }
 
 func init() {
-	fmt.Println(`
+	fmt.Print(`
  _____                ____                _           _         
 |   | |_ _ ___ ___   |    \ ___ _ _ _ ___| |___ ___ _| |___ ___ 
 | | | | | | . |_ -|  |  |  | . | | | |   | | . | .'| . | -_|  _|
@@ -1607,7 +4693,6 @@ func init() {
 }
 
 func main() {
-	var token string
 	scriptDir, err := getScriptDir()
 	if err != nil {
 		panic(err)
@@ -1620,62 +4705,123 @@ func main() {
 	if err != nil {
 		handleErr("Failed to parse config/args.", err, true)
 	}
+	if cfg.VerifyPath != "" {
+		failed, err := verifyFolder(cfg.VerifyPath)
+		if err != nil {
+			handleErr("Failed to verify folder.", err, true)
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+		return
+	}
 	err = makeDirs(cfg.OutPath)
 	if err != nil {
 		handleErr("Failed to make output folder.", err, true)
 	}
-	if cfg.Token == "" {
-		token, err = auth(cfg.Email, cfg.Password)
+	// Ctrl+C cancels in-flight requests and downloads. Pressing it again exits straight away.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	sess, err := login(ctx, cfg)
+	if err != nil {
+		handleErr("Failed to sign in.", err, true)
+	}
+	fmt.Println(
+		"Signed in successfully - " + sess.PlanDesc + "\n",
+	)
+	streamParams := sess.StreamParams
+	legacyToken, uguID := sess.LegacyToken, sess.UguID
+	if cfg.ExportPath != "" {
+		err = export(ctx, cfg, legacyToken)
 		if err != nil {
-			handleErr("Failed to auth.", err, true)
+			handleErr("Failed to export metadata.", err, true)
 		}
-	} else {
-		token = cfg.Token
+		return
 	}
-	userId, err := getUserInfo(token)
-	if err != nil {
-		handleErr("Failed to get user info.", err, true)
+	if cfg.Watch {
+		err = watch(ctx, cfg, sess)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			handleErr("Failed to watch artists.", err, true)
+		}
+		return
 	}
-	subInfo, err := getSubInfo(token)
-	if err != nil {
-		handleErr("Failed to get subcription info.", err, true)
+	if cfg.Scan {
+		err = scan(ctx, cfg, streamParams)
+		if err != nil {
+			handleErr("Failed to scan output path.", err, true)
+		}
+		return
 	}
-	legacyToken, uguID, err := extractLegToken(token)
-	if err != nil {
-		handleErr("Failed to extract legacy token.", err, true)
+	if cfg.Search != "" {
+		queued, err := search(ctx, cfg)
+		if err != nil {
+			handleErr("Search failed.", err, true)
+		}
+		cfg.Urls = append(cfg.Urls, queued...)
 	}
-	planDesc, isPromo := getPlan(subInfo)
-	if !subInfo.IsContentAccessible {
-		planDesc = "no active subscription"
+	if len(cfg.Library) > 0 {
+		queued, err := library(ctx, cfg, legacyToken)
+		if err != nil {
+			handleErr("Failed to get library.", err, true)
+		}
+		cfg.Urls = append(cfg.Urls, queued...)
+	}
+	if cfg.MirrorPlists {
+		err = mirrorPlists(ctx, legacyToken, cfg, streamParams)
+		if err != nil {
+			handleErr("Failed to mirror playlists.", err, true)
+		}
 	}
-	fmt.Println(
-		"Signed in successfully - " + planDesc + "\n",
-	)
-	streamParams := parseStreamParams(userId, subInfo, isPromo)
 	albumTotal := len(cfg.Urls)
 	var itemErr error
 	for albumNum, _url := range cfg.Urls {
+		if ctx.Err() != nil {
+			fmt.Println("Interrupted.")
+			return
+		}
 		fmt.Printf("Item %d of %d:\n", albumNum+1, albumTotal)
-		itemId, mediaType := checkUrl(_url)
-		if itemId == "" {
-			fmt.Println("Invalid URL:", _url)
+		ref, err := parseUrl(ctx, _url, true)
+		if err != nil {
+			handleErr("Invalid URL or specifier: "+_url, err, false)
+			continue
+		}
+		itemId := ref.ID
+		if cfg.ListFormats {
+			itemErr = listFormats(ctx, itemId, ref.Kind, cfg, streamParams)
+			if itemErr != nil {
+				handleErr("Item failed.", itemErr, false)
+			}
 			continue
 		}
-		switch mediaType {
-		case 0:
-			itemErr = album(itemId, cfg, streamParams, nil)
-		case 1, 2:
-			itemErr = playlist(itemId, legacyToken, cfg, streamParams, false)
-		case 3:
-			itemErr = catalogPlist(itemId, legacyToken, cfg, streamParams)
-		case 4, 10:
-			itemErr = video(itemId, "", cfg, streamParams, nil, false)
-		case 5:
-			itemErr = artist(itemId, cfg, streamParams)
-		case 6, 7, 8:
-			itemErr = video(itemId, "", cfg, streamParams, nil, true)
-		case 9:
-			itemErr = paidLstream(itemId, uguID, cfg, streamParams)
+		switch ref.Kind {
+		case KindRelease:
+			itemErr = album(ctx, itemId, cfg, streamParams, nil)
+		case KindUserPlaylist:
+			itemErr = playlist(ctx, itemId, legacyToken, cfg, streamParams, false)
+		case KindCatPlaylist:
+			itemErr = playlist(ctx, itemId, legacyToken, cfg, streamParams, true)
+		case KindVideo:
+			itemErr = video(ctx, itemId, "", cfg, streamParams, nil, false)
+		case KindArtist:
+			if cfg.Sync {
+				itemErr = syncArtist(ctx, itemId, cfg, streamParams, nil)
+			} else {
+				itemErr = artist(ctx, itemId, cfg, streamParams)
+			}
+		case KindLivestream:
+			if cfg.Schedule {
+				itemErr = scheduleLstream(ctx, itemId, cfg, streamParams)
+			} else {
+				itemErr = video(ctx, itemId, "", cfg, streamParams, nil, true)
+			}
+		case KindWebcast:
+			itemErr = video(ctx, itemId, "", cfg, streamParams, nil, true)
+		case KindPaidLivestream:
+			itemErr = paidLstream(ctx, itemId, uguID, cfg, streamParams)
 		}
 		if itemErr != nil {
 			handleErr("Item failed.", itemErr, false)
@@ -0,0 +1,551 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sorrow446/Nugs-Downloader/nugs"
+	"github.com/grafov/m3u8"
+)
+
+func TestParseUrl(t *testing.T) {
+	tests := []struct {
+		rawUrl string
+		want   *MediaRef
+	}{
+		{"https://play.nugs.net/release/23329", &MediaRef{KindRelease, "23329"}},
+		{"play.nugs.net/release/23329/", &MediaRef{KindRelease, "23329"}},
+		{"https://www.play.nugs.net/release/23329", &MediaRef{KindRelease, "23329"}},
+		{"https://play.nugs.net/#/release/23329", &MediaRef{KindRelease, "23329"}},
+		{"https://play.nugs.net/playlists/playlist/1215400", &MediaRef{KindUserPlaylist, "1215400"}},
+		{"https://play.nugs.net/library/playlist/1215400", &MediaRef{KindUserPlaylist, "1215400"}},
+		{
+			"https://2nu.gs/linkShare?plGUID=a0c8ab2b-bff0-4a6e-80b8-e0be5d6bd8e0",
+			&MediaRef{KindCatPlaylist, "a0c8ab2b-bff0-4a6e-80b8-e0be5d6bd8e0"},
+		},
+		{
+			"https://play.nugs.net/#/playlists/catalog?plGUID=a0c8ab2b",
+			&MediaRef{KindCatPlaylist, "a0c8ab2b"},
+		},
+		{"https://play.nugs.net/videos/artist/1045/Dead%20and%20Company/27323", &MediaRef{KindVideo, "27323"}},
+		{"https://play.nugs.net/artist/461", &MediaRef{KindArtist, "461"}},
+		{"https://play.nugs.net/artist/461/latest", &MediaRef{KindArtist, "461"}},
+		{"https://play.nugs.net/livestream/30119/exclusive", &MediaRef{KindLivestream, "30119"}},
+		{"https://play.nugs.net/watch/livestreams/exclusive/30119", &MediaRef{KindLivestream, "30119"}},
+		{"https://play.nugs.net/my-webcasts/5826189-30369-0-624602", &MediaRef{KindWebcast, "30369"}},
+		{"https://play.nugs.net/library/webcast/30369", &MediaRef{KindVideo, "30369"}},
+		{
+			"https://www.nugs.net/on/demandware.store/Sites-NugsNet-Site/default/Stash-QueueVideo?skuID=624598&showID=30367",
+			&MediaRef{KindPaidLivestream, "skuID=624598&showID=30367"},
+		},
+		{"release:23329", &MediaRef{KindRelease, "23329"}},
+		{"Artist:461", &MediaRef{KindArtist, "461"}},
+		{"webcast:5826189-30369-0-624602", &MediaRef{KindWebcast, "30369"}},
+	}
+	for _, test := range tests {
+		got, err := parseUrl(context.Background(), test.rawUrl, false)
+		if err != nil {
+			t.Errorf("parseUrl(%q) failed: %s", test.rawUrl, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseUrl(%q) = %+v, want %+v", test.rawUrl, got, test.want)
+		}
+	}
+}
+
+func TestParseUrlInvalid(t *testing.T) {
+	tests := []string{
+		"https://play.nugs.net/release/abc",
+		"https://play.nugs.net/search",
+		"https://www.nugs.net/on/demandware.store/Sites-NugsNet-Site/default/Stash-QueueVideo?skuID=624598",
+		"ftp://play.nugs.net/release/23329",
+		"release:abc",
+		// Only allowlisted short link hosts are followed.
+		"https://example.com/release/23329",
+		"https://2nu.gs/abcd",
+		// Catalog playlist GUIDs are only taken from nugs links.
+		"https://example.com/linkShare?plGUID=a0c8ab2b",
+	}
+	for _, rawUrl := range tests {
+		ref, err := parseUrl(context.Background(), rawUrl, false)
+		if err == nil {
+			t.Errorf("parseUrl(%q) = %+v, want an error", rawUrl, ref)
+		}
+	}
+}
+
+func TestMoveReorderedTracks(t *testing.T) {
+	plistPath := t.TempDir()
+	for _, fname := range []string{"01. Tell Me.flac", "02. Dust in a Baggie.flac"} {
+		err := os.WriteFile(filepath.Join(plistPath, fname), []byte(fname), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	state := &PlistState{Tracks: map[string]string{
+		"1": "01. Tell Me.flac",
+		"2": "02. Dust in a Baggie.flac",
+	}}
+	// The two tracks have swapped places.
+	tracks := []nugs.Track{
+		{TrackID: 2, SongTitle: "Dust in a Baggie"},
+		{TrackID: 1, SongTitle: "Tell Me"},
+	}
+	err := moveReorderedTracks(plistPath, tracks, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for fname, wantData := range map[string]string{
+		"01. Dust in a Baggie.flac": "02. Dust in a Baggie.flac",
+		"02. Tell Me.flac":          "01. Tell Me.flac",
+	} {
+		data, err := os.ReadFile(filepath.Join(plistPath, fname))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != wantData {
+			t.Errorf("%s has %q, want %q", fname, data, wantData)
+		}
+	}
+	if state.Tracks["1"] != "02. Tell Me.flac" {
+		t.Errorf("state wasn't updated, track 1 is %q", state.Tracks["1"])
+	}
+}
+
+func TestDownloadLstreamPolls(t *testing.T) {
+	// Empty at go-live, then a sliding window, then the end of the event.
+	playlists := []string{
+		"#EXTM3U\n#EXT-X-TARGETDURATION:0.01\n#EXT-X-MEDIA-SEQUENCE:0\n",
+		"#EXTM3U\n#EXT-X-TARGETDURATION:0.01\n#EXT-X-MEDIA-SEQUENCE:0\n" +
+			"#EXTINF:0.01,\na.ts\n#EXTINF:0.01,\nb.ts\n",
+		"#EXTM3U\n#EXT-X-TARGETDURATION:0.01\n#EXT-X-MEDIA-SEQUENCE:1\n" +
+			"#EXTINF:0.01,\nb.ts\n#EXTINF:0.01,\nc.ts\n#EXT-X-ENDLIST\n",
+	}
+	var fetches int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/media.m3u8" {
+			fmt.Fprint(w, playlists[min(fetches, len(playlists)-1)])
+			fetches++
+			return
+		}
+		fmt.Fprint(w, strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), ".ts"))
+	}))
+	defer server.Close()
+	videoPath := filepath.Join(t.TempDir(), "video.ts")
+	err := downloadLstream(context.Background(), videoPath, server.URL+"/", server.URL+"/media.m3u8", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(videoPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "abc" {
+		t.Errorf("got segments %q, want abc", data)
+	}
+}
+
+func TestIsSingleFile(t *testing.T) {
+	tests := []struct {
+		segPlaylist *SegPlaylist
+		want        bool
+	}{
+		{&SegPlaylist{SegUrls: []string{"v.ts", "v.ts"}, Ended: true}, true},
+		{&SegPlaylist{SegUrls: []string{"v.ts"}, Ended: true}, true},
+		// A live playlist with one segment so far.
+		{&SegPlaylist{SegUrls: []string{"1.ts"}}, false},
+		{&SegPlaylist{}, false},
+		{&SegPlaylist{SegUrls: []string{"1.ts", "2.ts"}, Ended: true}, false},
+	}
+	for _, test := range tests {
+		got := isSingleFile(test.segPlaylist)
+		if got != test.want {
+			t.Errorf("isSingleFile(%+v) = %t, want %t", test.segPlaylist, got, test.want)
+		}
+	}
+}
+
+// A session expiring mid-watch has to reach watch so it can sign in again,
+// even though the 401 comes from a track inside an album.
+func TestPollArtistsUnauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bigriver/subPlayer.aspx" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Query().Get("method") {
+		case "catalog.containersAll":
+			if r.URL.Query().Get("startOffset") != "1" {
+				fmt.Fprint(w, `{"Response": {"containers": []}}`)
+				return
+			}
+			fmt.Fprint(w, `{"Response": {"containers": [
+				{"containerID": 2, "artistName": "Billy Strings", "containerInfo": "10/29/22 Asheville, NC",
+				 "epochDateCreated": 100}]}}`)
+		case "catalog.container":
+			fmt.Fprint(w, `{"Response": {"containerID": 2, "artistName": "Billy Strings",
+				"containerInfo": "10/29/22 Asheville, NC", "tracks": [{"trackID": 3, "songTitle": "Intro"}]}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	origApi := api
+	defer func() { api = origApi }()
+	api = nugs.NewClient(server.Client())
+	api.StreamApiBase = server.URL + "/"
+
+	tmpPath := t.TempDir()
+	cfg := &Config{
+		Format:          2,
+		OutPath:         filepath.Join(tmpPath, "out"),
+		SyncStatePath:   filepath.Join(tmpPath, "sync.json"),
+		FollowedArtists: []string{"1"},
+	}
+	sess := &Session{StreamParams: &nugs.StreamParams{}}
+	var logBuf strings.Builder
+	logger := log.New(&logBuf, "", 0)
+	err := pollArtists(context.Background(), cfg, sess, logger)
+	if !errors.Is(err, nugs.ErrUnauthorized) {
+		t.Fatalf("got %v, want nugs.ErrUnauthorized", err)
+	}
+	_, err = os.Stat(cfg.SyncStatePath)
+	if !os.IsNotExist(err) {
+		t.Error("sync state was moved past the failed release")
+	}
+}
+
+func TestCheckUpgrade(t *testing.T) {
+	tests := []struct {
+		oldPath   string
+		oldFormat int
+		newFormat int
+		want      bool
+		wantErr   error
+	}{
+		// Nothing stored, so --upgrade mustn't download it.
+		{"", 0, 3, false, errNotStored},
+		{"01. Intro.m4a", 5, 2, true, nil},
+		{"01. Intro.flac", 2, 3, true, nil},
+		{"01. Intro.flac", 2, 1, false, nil},
+		{"01. Intro.flac", 3, 2, false, nil},
+		{"01. Intro.flac", 3, 3, false, nil},
+	}
+	for _, test := range tests {
+		got, err := checkUpgrade(test.oldPath, test.oldFormat, test.newFormat)
+		if got != test.want || !errors.Is(err, test.wantErr) {
+			t.Errorf("checkUpgrade(%q, %d, %d) = %t, %v, want %t, %v",
+				test.oldPath, test.oldFormat, test.newFormat, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestFindTrackFile(t *testing.T) {
+	folPath := t.TempDir()
+	for _, fname := range []string{"01. Intro.flac", "2 - Dust in a Baggie.flac", "03 Away.flac", "3 Away.m4a", "notes.txt"} {
+		err := os.WriteFile(filepath.Join(folPath, fname), []byte(fname), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		trackNum int
+		title    string
+		want     string
+	}{
+		{1, "Intro", "01. Intro.flac"},
+		{2, "Dust in a Baggie", "2 - Dust in a Baggie.flac"},
+		// Two files numbered 3 and no title tags to tell them apart.
+		{3, "Away From the Mire", ""},
+		{4, "Meet Me at the Creek", ""},
+	}
+	for _, test := range tests {
+		got, err := findTrackFile(folPath, test.trackNum, &nugs.Track{SongTitle: test.title})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.want != "" {
+			test.want = filepath.Join(folPath, test.want)
+		}
+		if got != test.want {
+			t.Errorf("findTrackFile(%d) = %q, want %q", test.trackNum, got, test.want)
+		}
+	}
+}
+
+func TestCheckDuration(t *testing.T) {
+	tests := []struct {
+		secs     float64
+		wantSecs int
+		wantErr  bool
+	}{
+		{600.4, 600, false},
+		{602, 600, false},
+		{420, 600, true},
+		{12, 0, false},
+		{1000, 1011, true},
+		{1005, 1011, false},
+	}
+	for _, test := range tests {
+		err := checkDuration(test.secs, test.wantSecs)
+		if (err != nil) != test.wantErr {
+			t.Errorf("checkDuration(%v, %d) = %v", test.secs, test.wantSecs, err)
+		}
+	}
+}
+
+func TestParseEventTime(t *testing.T) {
+	got, err := parseEventTime("10/29/2022 19:30:00", -4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2022, 10, 29, 23, 30, 0, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Errorf("parseEventTime = %s, want %s", got.UTC(), want)
+	}
+	_, err = parseEventTime("29 Oct 2022", 0)
+	if err == nil {
+		t.Error("parseEventTime accepted an unsupported layout")
+	}
+}
+
+func TestCleanChapters(t *testing.T) {
+	videoChapters := []nugs.VideoChapter{
+		{ChapterName: "Second", ChapterSeconds: 60},
+		{ChapterName: "First", ChapterSeconds: 0},
+		{ChapterName: "First Again", ChapterSeconds: 0.5},
+		{ChapterName: "", ChapterSeconds: 120},
+		{ChapterName: "Past The End", ChapterSeconds: 500},
+		{ChapterName: "Negative", ChapterSeconds: -1},
+	}
+	want := []*Chapter{
+		{Title: "First / First Again", Start: 0, End: 60},
+		{Title: "Second", Start: 60, End: 120},
+		{Title: "Chapter 3", Start: 120, End: 300},
+	}
+	got := cleanChapters(videoChapters, 300)
+	if !reflect.DeepEqual(got, want) {
+		for _, chapter := range got {
+			t.Logf("%+v", chapter)
+		}
+		t.Errorf("cleanChapters returned %d chapters, want %d", len(got), len(want))
+	}
+}
+
+func TestParseManifestLine(t *testing.T) {
+	tests := []struct {
+		line      string
+		isFfp     bool
+		wantFname string
+		wantHash  string
+		wantOk    bool
+	}{
+		{"D41D8CD98F00B204E9800998ECF8427E *01. Intro.flac", false, "01. Intro.flac", "d41d8cd98f00b204e9800998ecf8427e", true},
+		{"d41d8cd98f00b204e9800998ecf8427e  01. Intro.flac", false, "01. Intro.flac", "d41d8cd98f00b204e9800998ecf8427e", true},
+		{"01. Intro: Live.flac:D41D8CD98F00B204E9800998ECF8427E", true, "01. Intro: Live.flac", "d41d8cd98f00b204e9800998ecf8427e", true},
+		{"nohash", false, "", "", false},
+		{"nohash", true, "", "", false},
+	}
+	for _, test := range tests {
+		fname, hash, ok := parseManifestLine(test.line, test.isFfp)
+		if fname != test.wantFname || hash != test.wantHash || ok != test.wantOk {
+			t.Errorf("parseManifestLine(%q, %t) = %q, %q, %t", test.line, test.isFfp, fname, hash, ok)
+		}
+	}
+}
+
+func TestParseVorbisComments(t *testing.T) {
+	var block []byte
+	appendStr := func(str string) {
+		block = binary.LittleEndian.AppendUint32(block, uint32(len(str)))
+		block = append(block, str...)
+	}
+	appendStr("reference libFLAC 1.3.2")
+	block = binary.LittleEndian.AppendUint32(block, 4)
+	appendStr("ARTIST=Billy Strings")
+	appendStr("album=10/29/22 Asheville, NC")
+	appendStr("DATE=2022-10-29")
+	appendStr("TITLE=Intro")
+	got, err := parseVorbisComments(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &TrackTags{Artist: "Billy Strings", Album: "10/29/22 Asheville, NC", Date: "2022-10-29", Title: "Intro"}
+	if *got != *want {
+		t.Errorf("parseVorbisComments = %+v, want %+v", got, want)
+	}
+	_, err = parseVorbisComments(block[:len(block)-3])
+	if err == nil {
+		t.Error("parseVorbisComments accepted truncated comments")
+	}
+}
+
+func TestMatchesFilter(t *testing.T) {
+	container := &nugs.AlbArtResp{
+		PerformanceDate:  "10/29/2022",
+		VenueName:        "Harrah's Cherokee Center",
+		VenueState:       "NC ",
+		ContainerTypeStr: "Show",
+	}
+	tests := []struct {
+		filter *ContainerFilter
+		want   bool
+	}{
+		{&ContainerFilter{State: "nc"}, true},
+		{&ContainerFilter{State: "TN"}, false},
+		{&ContainerFilter{ContainerType: "show", Year: 2022}, true},
+		{&ContainerFilter{Year: 2023}, false},
+		{&ContainerFilter{VenueContains: "cherokee"}, true},
+		{&ContainerFilter{Since: time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC)}, false},
+		{&ContainerFilter{Until: time.Date(2022, 10, 29, 0, 0, 0, 0, time.UTC)}, true},
+	}
+	for _, test := range tests {
+		got := matchesFilter(container, test.filter)
+		if got != test.want {
+			t.Errorf("matchesFilter(%+v) = %t, want %t", test.filter, got, test.want)
+		}
+	}
+}
+
+func TestParseSelection(t *testing.T) {
+	tests := []struct {
+		selection string
+		want      []int
+		wantErr   bool
+	}{
+		{"all", []int{1, 2, 3, 4}, false},
+		{"1, 3", []int{1, 3}, false},
+		{"2-4", []int{2, 3, 4}, false},
+		{"1,3-4", []int{1, 3, 4}, false},
+		{"0", nil, true},
+		{"5", nil, true},
+		{"3-2", nil, true},
+		{"x", nil, true},
+	}
+	for _, test := range tests {
+		got, err := parseSelection(test.selection, 4)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseSelection(%q) error = %v, want error %t", test.selection, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseSelection(%q) = %v, want %v", test.selection, got, test.want)
+		}
+	}
+}
+
+func TestGetSortedHeights(t *testing.T) {
+	variants := []*m3u8.Variant{
+		{VariantParams: m3u8.VariantParams{Resolution: "1920x1080"}},
+		{VariantParams: m3u8.VariantParams{Resolution: "640x360"}},
+		{VariantParams: m3u8.VariantParams{Resolution: "1280x720"}},
+		{VariantParams: m3u8.VariantParams{Resolution: "1920x1080"}},
+		{VariantParams: m3u8.VariantParams{}},
+	}
+	want := []int{360, 720, 1080}
+	got := getSortedHeights(variants)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getSortedHeights = %v, want %v", got, want)
+	}
+}
+
+func TestGetFallbackHeight(t *testing.T) {
+	heights := []int{360, 720, 1080}
+	tests := []struct {
+		heights    []int
+		wantHeight int
+		want       int
+	}{
+		{heights, 720, 720},
+		// 480 and 2160 aren't there, so the nearest lower one is used.
+		{heights, 480, 360},
+		{heights, 2160, 1080},
+		// Nothing lower, so the nearest higher one is used.
+		{heights, 240, 360},
+		{nil, 1080, 0},
+	}
+	for _, test := range tests {
+		got := getFallbackHeight(test.heights, test.wantHeight)
+		if got != test.want {
+			t.Errorf("getFallbackHeight(%v, %d) = %d, want %d", test.heights, test.wantHeight, got, test.want)
+		}
+	}
+}
+
+func TestChooseVariant(t *testing.T) {
+	// Listed lowest bandwidth first to check they're sorted.
+	master := "#EXTM3U\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360\n360.m3u8\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=5000000,RESOLUTION=1920x1080\n1080.m3u8\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=3000000,RESOLUTION=1280x720\n720.m3u8\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, master)
+	}))
+	defer server.Close()
+	tests := []struct {
+		name    string
+		cfg     *Config
+		wantUri string
+		wantRes string
+		wantErr bool
+	}{
+		{"1080", &Config{WantRes: "1080"}, "1080.m3u8", "1080p", false},
+		{"unavailable 480", &Config{WantRes: "480"}, "360.m3u8", "360p", false},
+		{"unavailable 2160", &Config{WantRes: "2160"}, "1080.m3u8", "1080p", false},
+		{"variant", &Config{WantRes: "1080", VariantNum: 2}, "720.m3u8", "720p", false},
+		{"out of range variant", &Config{WantRes: "1080", VariantNum: 4}, "", "", true},
+		{"max bitrate", &Config{WantRes: "360", MaxBitrate: true}, "1080.m3u8", "1080p", false},
+		{"variant over max bitrate", &Config{VariantNum: 3, MaxBitrate: true}, "360.m3u8", "360p", false},
+	}
+	for _, test := range tests {
+		variant, res, err := chooseVariant(context.Background(), server.URL+"/master.m3u8", test.cfg)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: got %s, want an error", test.name, variant.URI)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if variant.URI != test.wantUri || res != test.wantRes {
+			t.Errorf("%s: got %s at %s, want %s at %s", test.name, variant.URI, res, test.wantUri, test.wantRes)
+		}
+	}
+}
+
+func TestResolveImgUrl(t *testing.T) {
+	tests := []struct {
+		imgUrl string
+		want   string
+	}{
+		{"https://example.com/a.jpg", "https://example.com/a.jpg"},
+		{"http://example.com/a.jpg", "http://example.com/a.jpg"},
+		{"//example.com/a.jpg", "https://example.com/a.jpg"},
+		{"/images/a.png", imgBase + "/images/a.png"},
+		{"images/a.png", imgBase + "/images/a.png"},
+		{" ", ""},
+	}
+	for _, test := range tests {
+		got := resolveImgUrl(test.imgUrl)
+		if got != test.want {
+			t.Errorf("resolveImgUrl(%q) = %q, want %q", test.imgUrl, got, test.want)
+		}
+	}
+	if ext := getImgExt(imgBase + "/images/a.PNG?w=500"); ext != ".png" {
+		t.Errorf("getImgExt = %q, want .png", ext)
+	}
+}
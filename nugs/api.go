@@ -0,0 +1,315 @@
+package nugs
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Auth signs in with an email and password and returns an access token.
+func (c *Client) Auth(ctx context.Context, email, pwd string) (string, error) {
+	data := url.Values{}
+	data.Set("client_id", clientId)
+	data.Set("grant_type", "password")
+	data.Set("scope", "openid profile email nugsnet:api nugsnet:legacyapi offline_access")
+	data.Set("username", email)
+	data.Set("password", pwd)
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, c.AuthUrl, strings.NewReader(data.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("User-Agent", UserAgent)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	body, err := c.send(req, c.AuthUrl)
+	if err != nil {
+		return "", err
+	}
+	var obj Auth
+	err = decode(body, c.AuthUrl, &obj)
+	if err != nil {
+		return "", err
+	}
+	return obj.AccessToken, nil
+}
+
+func (c *Client) GetUserInfo(ctx context.Context, token string) (*UserInfo, error) {
+	body, err := c.getWithToken(ctx, c.UserInfoUrl, token)
+	if err != nil {
+		return nil, err
+	}
+	var obj UserInfo
+	err = decode(body, c.UserInfoUrl, &obj)
+	if err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+func (c *Client) GetSubInfo(ctx context.Context, token string) (*SubInfo, error) {
+	body, err := c.getWithToken(ctx, c.SubInfoUrl, token)
+	if err != nil {
+		return nil, err
+	}
+	var obj SubInfo
+	err = decode(body, c.SubInfoUrl, &obj)
+	if err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+// GetAlbumMeta gets a container, which can be a release, video or livestream.
+func (c *Client) GetAlbumMeta(ctx context.Context, albumId string) (*AlbumMeta, error) {
+	query := url.Values{}
+	query.Set("method", "catalog.container")
+	query.Set("containerID", albumId)
+	query.Set("vdisp", "1")
+	body, err := c.getStreamApi(ctx, "api.aspx", query, UserAgent)
+	if err != nil {
+		return nil, err
+	}
+	var obj AlbumMeta
+	err = decode(body, "catalog.container", &obj)
+	if err != nil {
+		return nil, err
+	}
+	var raw rawAlbumMeta
+	err = decode(body, "catalog.container", &raw)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Response != nil {
+		obj.Response.Raw = raw.Response
+	}
+	return &obj, nil
+}
+
+// GetPlistMeta gets a user playlist by ID, or a catalog playlist by GUID if cat is true.
+// Only user playlists need the email and legacy token.
+func (c *Client) GetPlistMeta(ctx context.Context, plistId, email, legacyToken string, cat bool) (*PlistMeta, error) {
+	var path string
+	query := url.Values{}
+	if cat {
+		path = "api.aspx"
+		query.Set("method", "catalog.playlist")
+		query.Set("plGUID", plistId)
+	} else {
+		path = "secureApi.aspx"
+		query.Set("method", "user.playlist")
+		query.Set("playlistID", plistId)
+		query.Set("developerKey", devKey)
+		query.Set("user", email)
+		query.Set("token", legacyToken)
+	}
+	body, err := c.getStreamApi(ctx, path, query, userAgentTwo)
+	if err != nil {
+		return nil, err
+	}
+	method := query.Get("method")
+	// Mirroring deletes what isn't in a user playlist, so it must really be empty.
+	if !cat {
+		err = checkList(body, method, "items")
+		if err != nil {
+			return nil, err
+		}
+	}
+	var obj PlistMeta
+	err = decode(body, method, &obj)
+	if err != nil {
+		return nil, err
+	}
+	if !cat {
+		for _, item := range obj.Response.Items {
+			if item.Track.TrackID == 0 {
+				return nil, &DecodeError{Endpoint: method, Err: ErrUnexpectedResponse}
+			}
+		}
+	}
+	var raw rawAlbumMeta
+	err = decode(body, method, &raw)
+	if err != nil {
+		return nil, err
+	}
+	obj.Raw = raw.Response
+	return &obj, nil
+}
+
+// GetArtistMeta pages through all of an artist's containers, 100 at a time.
+// stop is called with each page and ends paging early if it returns true.
+func (c *Client) GetArtistMeta(ctx context.Context, artistId string, stop func(*ArtistMeta) bool) ([]*ArtistMeta, error) {
+	var allArtistMeta []*ArtistMeta
+	offset := 1
+	query := url.Values{}
+	query.Set("method", "catalog.containersAll")
+	query.Set("limit", "100")
+	query.Set("artistList", artistId)
+	query.Set("availType", "1")
+	query.Set("vdisp", "1")
+	for {
+		query.Set("startOffset", strconv.Itoa(offset))
+		body, err := c.getStreamApi(ctx, "api.aspx", query, UserAgent)
+		if err != nil {
+			return nil, err
+		}
+		var obj ArtistMeta
+		err = decode(body, "catalog.containersAll", &obj)
+		if err != nil {
+			return nil, err
+		}
+		var raw rawArtistMeta
+		err = decode(body, "catalog.containersAll", &raw)
+		if err != nil {
+			return nil, err
+		}
+		for i, container := range obj.Response.Containers {
+			if i < len(raw.Response.Containers) {
+				container.Raw = raw.Response.Containers[i]
+			}
+		}
+		retLen := len(obj.Response.Containers)
+		if retLen == 0 {
+			break
+		}
+		allArtistMeta = append(allArtistMeta, &obj)
+		if stop != nil && stop(&obj) {
+			break
+		}
+		offset += retLen
+	}
+	return allArtistMeta, nil
+}
+
+// GetPurchasedManUrl gets the manifest URL of a purchased livestream or video.
+func (c *Client) GetPurchasedManUrl(ctx context.Context, skuID int, showID, userID, uguID string) (string, error) {
+	query := url.Values{}
+	query.Set("skuId", strconv.Itoa(skuID))
+	query.Set("showId", showID)
+	query.Set("uguid", uguID)
+	query.Set("nn_userID", userID)
+	query.Set("app", "1")
+	body, err := c.getStreamApi(ctx, "bigriver/vidPlayer.aspx", query, userAgentTwo)
+	if err != nil {
+		return "", err
+	}
+	var obj PurchasedManResp
+	err = decode(body, "bigriver/vidPlayer.aspx", &obj)
+	if err != nil {
+		return "", err
+	}
+	return obj.FileURL, nil
+}
+
+// GetStreamMeta gets the stream URL of a track in the given format.
+// A format of 0 gets the video manifest of the container trackId with skuId instead.
+func (c *Client) GetStreamMeta(ctx context.Context, trackId, skuId, format int, streamParams *StreamParams) (string, error) {
+	query := url.Values{}
+	if format == 0 {
+		query.Set("skuId", strconv.Itoa(skuId))
+		query.Set("containerID", strconv.Itoa(trackId))
+		query.Set("chap", "1")
+	} else {
+		query.Set("platformID", strconv.Itoa(format))
+		query.Set("trackID", strconv.Itoa(trackId))
+	}
+	query.Set("app", "1")
+	query.Set("subscriptionID", streamParams.SubscriptionID)
+	query.Set("subCostplanIDAccessList", streamParams.SubCostplanIDAccessList)
+	query.Set("nn_userID", streamParams.UserID)
+	query.Set("startDateStamp", streamParams.StartStamp)
+	query.Set("endDateStamp", streamParams.EndStamp)
+	body, err := c.getStreamApi(ctx, "bigriver/subPlayer.aspx", query, userAgentTwo)
+	if err != nil {
+		return "", err
+	}
+	var obj StreamMeta
+	err = decode(body, "bigriver/subPlayer.aspx", &obj)
+	if err != nil {
+		return "", err
+	}
+	return obj.StreamLink, nil
+}
+
+// Search searches the catalog for artists, shows and songs.
+func (c *Client) Search(ctx context.Context, searchStr string) (*SearchMeta, error) {
+	query := url.Values{}
+	query.Set("method", "catalog.search")
+	query.Set("searchStr", searchStr)
+	query.Set("vdisp", "1")
+	body, err := c.getStreamApi(ctx, "api.aspx", query, UserAgent)
+	if err != nil {
+		return nil, err
+	}
+	var obj SearchMeta
+	err = decode(body, "catalog.search", &obj)
+	if err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+func (c *Client) getUserMeta(ctx context.Context, method, listKey, email, legacyToken string, obj interface{}) error {
+	query := url.Values{}
+	query.Set("method", method)
+	query.Set("developerKey", devKey)
+	query.Set("user", email)
+	query.Set("token", legacyToken)
+	body, err := c.getStreamApi(ctx, "secureApi.aspx", query, userAgentTwo)
+	if err != nil {
+		return err
+	}
+	err = checkList(body, method, listKey)
+	if err != nil {
+		return err
+	}
+	return decode(body, method, obj)
+}
+
+// GetUserPlists lists the playlists owned by the signed-in user.
+// The user.* list methods take the same parameters as user.playlist. Their responses
+// are checked for the list and item IDs, and fail with ErrUnexpectedResponse otherwise.
+func (c *Client) GetUserPlists(ctx context.Context, email, legacyToken string) (*UserPlistsMeta, error) {
+	var obj UserPlistsMeta
+	err := c.getUserMeta(ctx, "user.playlists", "items", email, legacyToken, &obj)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range obj.Response.Items {
+		if item.ID == 0 {
+			return nil, &DecodeError{Endpoint: "user.playlists", Err: ErrUnexpectedResponse}
+		}
+	}
+	return &obj, nil
+}
+
+// GetUserFavs lists the signed-in user's favorited shows.
+func (c *Client) GetUserFavs(ctx context.Context, email, legacyToken string) (*UserFavsMeta, error) {
+	var obj UserFavsMeta
+	err := c.getUserMeta(ctx, "user.favorites", "containers", email, legacyToken, &obj)
+	if err != nil {
+		return nil, err
+	}
+	for _, container := range obj.Response.Containers {
+		if container == nil || container.ContainerID == 0 {
+			return nil, &DecodeError{Endpoint: "user.favorites", Err: ErrUnexpectedResponse}
+		}
+	}
+	return &obj, nil
+}
+
+// GetUserStash lists the signed-in user's purchases.
+func (c *Client) GetUserStash(ctx context.Context, email, legacyToken string) (*UserStashMeta, error) {
+	var obj UserStashMeta
+	err := c.getUserMeta(ctx, "user.stash", "items", email, legacyToken, &obj)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range obj.Response.Items {
+		if item == nil || (item.ContainerID == 0 && item.ShowID == 0) {
+			return nil, &DecodeError{Endpoint: "user.stash", Err: ErrUnexpectedResponse}
+		}
+	}
+	return &obj, nil
+}
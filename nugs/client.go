@@ -0,0 +1,131 @@
+// Package nugs is a client for the nugs.net auth, subscription and catalog APIs.
+package nugs
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+)
+
+const (
+	devKey       = "x7f54tgbdyc64y656thy47er4"
+	clientId     = "Eg7HuH873H65r5rt325UytR5429"
+	userAgentTwo = "nugsnetAndroid"
+)
+
+// UserAgent is the Android app's, which media downloads should also send.
+const UserAgent = "NugsNet/3.26.724 (Android; 7.1.2; Asus; ASUS_Z01QD; Scale/2.0; en)"
+
+// Client is safe for concurrent use once its fields are set. Create one with NewClient.
+type Client struct {
+	httpClient *http.Client
+	// Where requests are sent. NewClient sets the real ones, tests can point them elsewhere.
+	AuthUrl       string
+	StreamApiBase string
+	SubInfoUrl    string
+	UserInfoUrl   string
+}
+
+// NewClient returns a Client that sends its requests with httpClient.
+// A nil httpClient gets a new one with a cookie jar.
+func NewClient(httpClient *http.Client) *Client {
+	if httpClient == nil {
+		jar, _ := cookiejar.New(nil)
+		httpClient = &http.Client{Jar: jar}
+	}
+	return &Client{
+		httpClient:    httpClient,
+		AuthUrl:       "https://id.nugs.net/connect/token",
+		StreamApiBase: "https://streamapi.nugs.net/",
+		SubInfoUrl:    "https://subscriptions.nugs.net/api/v1/me/subscriptions",
+		UserInfoUrl:   "https://id.nugs.net/connect/userinfo",
+	}
+}
+
+func (c *Client) send(req *http.Request, endpoint string) ([]byte, error) {
+	do, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer do.Body.Close()
+	if do.StatusCode != http.StatusOK {
+		return nil, &StatusError{Endpoint: endpoint, StatusCode: do.StatusCode, Status: do.Status}
+	}
+	return io.ReadAll(do.Body)
+}
+
+// Sends a GET to the stream API. Errors are labelled with the API method if there is one.
+func (c *Client) getStreamApi(ctx context.Context, path string, query url.Values, userAgent string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.StreamApiBase+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawQuery = query.Encode()
+	req.Header.Add("User-Agent", userAgent)
+	endpoint := query.Get("method")
+	if endpoint == "" {
+		endpoint = path
+	}
+	return c.send(req, endpoint)
+}
+
+// Sends a GET with a bearer token to the id or subscriptions API.
+func (c *Client) getWithToken(ctx context.Context, _url, token string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, _url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", "Bearer "+token)
+	req.Header.Add("User-Agent", UserAgent)
+	return c.send(req, _url)
+}
+
+func decode(body []byte, endpoint string, obj interface{}) error {
+	err := json.Unmarshal(body, obj)
+	if err != nil {
+		return &DecodeError{Endpoint: endpoint, Err: err}
+	}
+	return nil
+}
+
+// checkList makes sure the response holds the list under listKey,
+// so that an error or changed response isn't mistaken for an empty list.
+func checkList(body []byte, endpoint, listKey string) error {
+	var obj struct {
+		Response map[string]json.RawMessage `json:"Response"`
+	}
+	err := decode(body, endpoint, &obj)
+	if err != nil {
+		return err
+	}
+	list := bytes.TrimSpace(obj.Response[listKey])
+	if !bytes.HasPrefix(list, []byte("[")) {
+		return &DecodeError{Endpoint: endpoint, Err: ErrUnexpectedResponse}
+	}
+	return nil
+}
+
+// ParseToken decodes the payload of an access token without verifying it.
+// The payload carries the legacy token and uguid the older APIs need.
+func ParseToken(tokenStr string) (*Payload, error) {
+	split := strings.SplitN(tokenStr, ".", 3)
+	if len(split) != 3 {
+		return nil, ErrMalformedToken
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(split[1])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	var obj Payload
+	err = decode(decoded, "token", &obj)
+	if err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
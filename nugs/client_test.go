@@ -0,0 +1,219 @@
+package nugs
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	c := NewClient(server.Client())
+	c.AuthUrl = server.URL + "/connect/token"
+	c.StreamApiBase = server.URL + "/"
+	c.SubInfoUrl = server.URL + "/api/v1/me/subscriptions"
+	c.UserInfoUrl = server.URL + "/connect/userinfo"
+	return c
+}
+
+func TestSendStatusErrors(t *testing.T) {
+	tests := []struct {
+		statusCode       int
+		wantUnauthorized bool
+		wantNotFound     bool
+	}{
+		{http.StatusUnauthorized, true, false},
+		{http.StatusForbidden, true, false},
+		{http.StatusNotFound, false, true},
+		{http.StatusInternalServerError, false, false},
+	}
+	for _, test := range tests {
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.statusCode)
+		})
+		_, err := c.GetUserInfo(context.Background(), "token")
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) {
+			t.Fatalf("%d: got %v, want a *StatusError", test.statusCode, err)
+		}
+		if statusErr.StatusCode != test.statusCode || statusErr.Endpoint != c.UserInfoUrl {
+			t.Errorf("%d: got %+v", test.statusCode, statusErr)
+		}
+		if errors.Is(err, ErrUnauthorized) != test.wantUnauthorized {
+			t.Errorf("%d: errors.Is(err, ErrUnauthorized) = %t", test.statusCode, !test.wantUnauthorized)
+		}
+		if errors.Is(err, ErrNotFound) != test.wantNotFound {
+			t.Errorf("%d: errors.Is(err, ErrNotFound) = %t", test.statusCode, !test.wantNotFound)
+		}
+	}
+}
+
+func TestGetWithToken(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"sub": "123"}`))
+	})
+	userInfo, err := c.GetUserInfo(context.Background(), "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userInfo.Sub != "123" {
+		t.Errorf("got sub %q, want 123", userInfo.Sub)
+	}
+}
+
+func TestStreamApiErrorsNameMethod(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("method") == "catalog.container" {
+			w.Write([]byte(`not json`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	})
+	_, err := c.GetAlbumMeta(context.Background(), "23329")
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("got %v, want a *DecodeError", err)
+	}
+	if decodeErr.Endpoint != "catalog.container" {
+		t.Errorf("got endpoint %q, want catalog.container", decodeErr.Endpoint)
+	}
+	_, err = c.GetPurchasedManUrl(context.Background(), 1, "2", "3", "4")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Endpoint != "bigriver/vidPlayer.aspx" {
+		t.Errorf("got %v, want a *StatusError for bigriver/vidPlayer.aspx", err)
+	}
+}
+
+func TestGetAlbumMetaKeepsRaw(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Response": {"containerID": 23329, "artistName": "Billy Strings"}}`))
+	})
+	meta, err := c.GetAlbumMeta(context.Background(), "23329")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Response.ContainerID != 23329 {
+		t.Errorf("got container ID %d, want 23329", meta.Response.ContainerID)
+	}
+	var raw map[string]interface{}
+	err = json.Unmarshal(meta.Response.Raw, &raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw["artistName"] != "Billy Strings" {
+		t.Errorf("raw metadata wasn't kept: %s", meta.Response.Raw)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	var obj Auth
+	err := decode([]byte(`{"access_token": 1}`), "token", &obj)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("got %v, want a *DecodeError", err)
+	}
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		t.Errorf("DecodeError doesn't unwrap to the JSON error: %v", err)
+	}
+	err = decode([]byte(`{"access_token": "abc"}`), "token", &obj)
+	if err != nil || obj.AccessToken != "abc" {
+		t.Errorf("got %v and %q", err, obj.AccessToken)
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	encode := func(payload string) string {
+		return "header." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".sig"
+	}
+	payload, err := ParseToken(encode(`{"sub": "123", "legacy_token": "abc", "legacy_uguid": "def"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload.Sub != "123" || payload.LegacyToken != "abc" || payload.LegacyUguid != "def" {
+		t.Errorf("got %+v", payload)
+	}
+	for _, tokenStr := range []string{"", "header.payload", "header.!!!.sig"} {
+		_, err = ParseToken(tokenStr)
+		if !errors.Is(err, ErrMalformedToken) {
+			t.Errorf("ParseToken(%q) = %v, want ErrMalformedToken", tokenStr, err)
+		}
+	}
+	_, err = ParseToken(encode(`not json`))
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Errorf("got %v, want a *DecodeError", err)
+	}
+}
+
+func TestUserListsFailClosed(t *testing.T) {
+	tests := []struct {
+		body    string
+		wantErr bool
+	}{
+		{`{"Response": {"items": [{"ID": 1215400, "playListName": "Road Trip"}]}}`, false},
+		{`{"Response": {"items": []}}`, false},
+		{`{"Response": null}`, true},
+		{`{"Response": {}}`, true},
+		{`{"responseAvailabilityCodeStr": "AVAILABLE"}`, true},
+		{`{"Response": {"items": null}}`, true},
+		{`{"Response": {"items": [{"playListName": "Road Trip"}]}}`, true},
+	}
+	for _, test := range tests {
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(test.body))
+		})
+		_, err := c.GetUserPlists(context.Background(), "email", "token")
+		if !test.wantErr {
+			if err != nil {
+				t.Errorf("%s: got %v", test.body, err)
+			}
+			continue
+		}
+		var decodeErr *DecodeError
+		if !errors.Is(err, ErrUnexpectedResponse) || !errors.As(err, &decodeErr) {
+			t.Errorf("%s: got %v, want ErrUnexpectedResponse", test.body, err)
+		}
+	}
+}
+
+func TestUserListsCheckIDs(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("method") {
+		case "user.favorites":
+			w.Write([]byte(`{"Response": {"containers": [{"artistName": "Billy Strings"}]}}`))
+		case "user.stash":
+			w.Write([]byte(`{"Response": {"containers": [{"containerID": 23329}]}}`))
+		case "user.playlist":
+			w.Write([]byte(`{"Response": {"playListName": "Road Trip", "items": [{"ID": 1}]}}`))
+		case "catalog.playlist":
+			w.Write([]byte(`{"Response": {"playListName": "Picks"}}`))
+		}
+	})
+	ctx := context.Background()
+	_, err := c.GetUserFavs(ctx, "email", "token")
+	if !errors.Is(err, ErrUnexpectedResponse) {
+		t.Errorf("favorites: got %v, want ErrUnexpectedResponse", err)
+	}
+	_, err = c.GetUserStash(ctx, "email", "token")
+	if !errors.Is(err, ErrUnexpectedResponse) {
+		t.Errorf("stash: got %v, want ErrUnexpectedResponse", err)
+	}
+	_, err = c.GetPlistMeta(ctx, "1215400", "email", "token", false)
+	if !errors.Is(err, ErrUnexpectedResponse) {
+		t.Errorf("user playlist: got %v, want ErrUnexpectedResponse", err)
+	}
+	_, err = c.GetPlistMeta(ctx, "abc", "", "", true)
+	if err != nil {
+		t.Errorf("catalog playlist: got %v", err)
+	}
+}
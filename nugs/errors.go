@@ -0,0 +1,54 @@
+package nugs
+
+import (
+	"errors"
+	"net/http"
+)
+
+var (
+	// ErrUnauthorized matches StatusErrors for 401 and 403 responses,
+	// e.g. when a token has expired.
+	ErrUnauthorized = errors.New("nugs: unauthorized")
+	// ErrNotFound matches StatusErrors for 404 responses.
+	ErrNotFound = errors.New("nugs: not found")
+	// ErrMalformedToken is returned by ParseToken for tokens that aren't JWTs.
+	ErrMalformedToken = errors.New("nugs: malformed token")
+	// ErrUnexpectedResponse is wrapped in a DecodeError when a response
+	// is valid JSON but is missing the list it should hold or its items lack IDs.
+	ErrUnexpectedResponse = errors.New("nugs: unexpected response")
+)
+
+// StatusError is returned when an endpoint responds with a non-200 status.
+type StatusError struct {
+	Endpoint   string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return e.Endpoint + ": " + e.Status
+}
+
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
+// DecodeError is returned when a response body isn't the expected JSON.
+type DecodeError struct {
+	Endpoint string
+	Err      error
+}
+
+func (e *DecodeError) Error() string {
+	return e.Endpoint + ": decoding response: " + e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
@@ -1,7 +1,38 @@
 package main
 
+import (
+	"encoding/xml"
+	"regexp"
+	"time"
+
+	"github.com/Sorrow446/Nugs-Downloader/nugs"
+)
+
 type Transport struct{}
 
+type MediaKind int
+
+const (
+	KindRelease MediaKind = iota + 1
+	KindUserPlaylist
+	KindCatPlaylist
+	KindVideo
+	KindArtist
+	KindLivestream
+	KindWebcast
+	KindPaidLivestream
+)
+
+type MediaRef struct {
+	Kind MediaKind
+	ID   string
+}
+
+type PlayerRoute struct {
+	Regex *regexp.Regexp
+	Kind  MediaKind
+}
+
 type WriteCounter struct {
 	Total      int64
 	TotalStr   string
@@ -24,421 +55,208 @@ type Config struct {
 	ForceVideo      bool
 	SkipVideos		bool
 	SkipChapters	bool
+
+	Schedule        bool
+	ScheduleRetry   int
+	VariantNum      int
+	MaxBitrate      bool
+	ListFormats     bool
+	VideoAudio      bool
+	ChapterFormats  []string
+	Nfo             string
+	AlbumM3u        bool
+	Cue             bool
+	Checksums       bool
+	VerifyPath      string
+	CheckIntegrity  bool
+	ArchivePath     string
+	Archive         *Archive
+	Scan            bool
+	ScanSeed        bool
+	Upgrade         bool
+	RemoveOld       bool
+	Sync            bool
+	SyncStatePath   string
+	Watch           bool
+	FollowedArtists []string
+	PollInterval    int
+	WatchLogPath    string
+	Filter          *ContainerFilter
+	Search          string
+	SearchType      string
+	Queue           bool
+	Library         []string
+	MirrorPlists    bool
+	ExportPath      string
+	ExportFormat    string
+	SaveMeta        bool
+	Artwork         string
+	Notes           bool
+	User            string
 }
 
 type Args struct {
-	Urls         []string `arg:"positional, required"`
+	Urls         []string `arg:"positional"`
 	Format       int      `arg:"-f" default:"-1" help:"Track download format.\n\t\t\t 1 = 16-bit / 44.1 kHz ALAC\n\t\t\t 2 = 16-bit / 44.1 kHz FLAC\n\t\t\t 3 = 24-bit / 48 kHz MQA\n\t\t\t 4 = 360 Reality Audio / best available\n\t\t\t 5 = 150 Kbps AAC"`
 	VideoFormat  int      `arg:"-F" default:"-1" help:"Video download format.\n\t\t\t 1 = 480p\n\t\t\t 2 = 720p\n\t\t\t 3 = 1080p\n\t\t\t 4 = 1440p\n\t\t\t 5 = 4K / best available"`
 	OutPath      string   `arg:"-o" help:"Where to download to. Path will be made if it doesn't already exist."`
 	ForceVideo   bool     `arg:"--force-video" help:"Forces video when it co-exists with audio in release URLs."`
 	SkipVideos   bool     `arg:"--skip-videos" help:"Skips videos in artist URLs."`
 	SkipChapters bool     `arg:"--skip-chapters" help:"Skips chapters for videos."`
+
+	Schedule       bool     `arg:"--schedule" help:"Waits for exclusive livestreams to start and records them when they go live."`
+	ScheduleRetry  int      `arg:"--schedule-retry" default:"30" help:"Seconds to wait between attempts while a scheduled livestream isn't up yet."`
+	MaxBitrate     bool     `arg:"--max-bitrate" help:"Downloads the highest bitrate video variant regardless of video format."`
+	VariantNum     int      `arg:"--variant" help:"Downloads the video variant with this number as shown by --list-formats. Overrides video format."`
+	ListFormats    bool     `arg:"--list-formats" help:"Lists the available audio formats and video variants of release, video and livestream URLs without downloading."`
+	VideoAudio     bool     `arg:"--video-audio" help:"Also splits the audio of videos into per-song M4A files using their chapters."`
+	ChapterFormats []string `arg:"--chapter-formats" help:"Also writes video chapters next to the MP4 in these formats: ffmeta, mkvxml, cue, vtt."`
+	Nfo            string   `arg:"--nfo" help:"Puts each video in its own folder with a Kodi/Plex/Jellyfin movie.nfo or musicvideo.nfo, poster and fanart. musicvideo or movie."`
+	AlbumM3u       bool     `arg:"--album-m3u" help:"Also writes an M3U8 for each album. Playlists always get one."`
+	Cue            bool     `arg:"--cue" help:"Also writes a CUE sheet for each album referencing its track files."`
+	Checksums      bool     `arg:"--checksums" help:"Writes MD5, SHA-256 and FLAC fingerprint (.ffp) manifests to each album folder."`
+	VerifyPath     string   `arg:"--verify" help:"Re-checks the files in this album folder against its checksum manifests and exits."`
+	CheckIntegrity bool     `arg:"--check-integrity" help:"Decodes FLACs against their MD5 and checks MP4 structure after downloading. Bad files are deleted and retried."`
+	ArchivePath    string   `arg:"--archive" help:"Download archive to record downloaded tracks and their formats in."`
+	Scan           bool     `arg:"--scan" help:"Audits the output path for missing, partial and lower quality tracks instead of downloading."`
+	ScanSeed       bool     `arg:"--scan-seed" help:"Adds the files found by --scan to the download archive."`
+	Upgrade        bool     `arg:"--upgrade" help:"Only re-downloads tracks whose stored format is lower than what's now available."`
+	RemoveOld      bool     `arg:"--remove-old" help:"Deletes the old files of tracks replaced by --upgrade."`
+	Sync           bool     `arg:"--sync" help:"Only downloads releases added to artist URLs since their last sync."`
+	Watch          bool     `arg:"--watch" help:"Keeps running and syncs the config's followed artists every poll interval."`
+	PollInterval   int      `arg:"--poll-interval" help:"Minutes between watch polls."`
+	Since          string   `arg:"--since" help:"Only downloads artist items performed on or after this date. YYYY-MM-DD."`
+	Until          string   `arg:"--until" help:"Only downloads artist items performed on or before this date. YYYY-MM-DD."`
+	Year           int      `arg:"--year" help:"Only downloads artist items performed in this year."`
+	VenueContains  string   `arg:"--venue-contains" help:"Only downloads artist items whose venue contains this text."`
+	State          string   `arg:"--state" help:"Only downloads artist items performed in this state, e.g. NC."`
+	ContainerType  string   `arg:"--container-type" help:"Only downloads artist items of this type, e.g. Show."`
+	Search         string   `arg:"--search" help:"Searches the catalog for artists, shows and songs. The filters apply to shows."`
+	SearchType     string   `arg:"--search-type" default:"all" help:"What to search for: all, artists, shows or songs."`
+	Queue          bool     `arg:"--queue" help:"Asks which search or library results to download."`
+	Library        []string `arg:"--library" help:"Downloads the signed-in user's library: playlists, favorites and/or stash. The filters apply to favorites and stash."`
+	MirrorPlists   bool     `arg:"--mirror-playlists" help:"Downloads all of the signed-in user's playlists and removes tracks that have dropped off them."`
+	ExportPath     string   `arg:"--export" help:"Writes the metadata of the URLs' tracks to this file instead of downloading."`
+	ExportFormat   string   `arg:"--export-format" help:"Export format: jsonl or csv. Taken from the export file's extension if not given."`
+	SaveMeta       bool     `arg:"--save-meta" help:"Writes the raw API metadata of each album and playlist to nugs_meta.json in its folder."`
+	Artwork        string   `arg:"--artwork" help:"all = also saves each album's CD artwork and gallery pictures to an Artwork folder."`
+	Notes          bool     `arg:"--notes" help:"Writes each album's notes and reviews to notes.txt and reviews.md, and tags new tracks with the notes. FFmpeg needed."`
 }
 
-type Auth struct {
-	AccessToken  string `json:"access_token"`
-	ExpiresIn    int    `json:"expires_in"`
-	TokenType    string `json:"token_type"`
-	RefreshToken string `json:"refresh_token"`
-	Scope        string `json:"scope"`
+type Chapter struct {
+	Title string
+	Start float64
+	End   float64
 }
 
-type Payload struct {
-	Nbf         int      `json:"nbf"`
-	Exp         int      `json:"exp"`
-	Iss         string   `json:"iss"`
-	Aud         []string `json:"aud"`
-	ClientID    string   `json:"client_id"`
-	Sub         string   `json:"sub"`
-	AuthTime    int      `json:"auth_time"`
-	Idp         string   `json:"idp"`
-	Email       string   `json:"email"`
-	LegacyToken string   `json:"legacy_token"`
-	LegacyUguid string   `json:"legacy_uguid"`
-	Jti         string   `json:"jti"`
-	Sid         string   `json:"sid"`
-	Iat         int      `json:"iat"`
-	Scope       []string `json:"scope"`
-	Amr         []string `json:"amr"`
+type Artwork struct {
+	Name string
+	URL  string
 }
 
-type UserInfo struct {
-	Sub               string `json:"sub"`
-	PreferredUsername string `json:"preferred_username"`
-	Name              string `json:"name"`
-	Email             string `json:"email"`
-	EmailVerified     bool   `json:"email_verified"`
+type M3uEntry struct {
+	Path     string
+	Title    string
+	Duration int
 }
 
-type SubInfo struct {
-	StripeMetaData struct {
-		SubscriptionID      string      `json:"subscriptionId"`
-		InvoiceID           string      `json:"invoiceId"`
-		PaymentIntentStatus interface{} `json:"paymentIntentStatus"`
-		ReturnURL           interface{} `json:"returnUrl"`
-		RedirectURL         interface{} `json:"redirectUrl"`
-		PaymentError        interface{} `json:"paymentError"`
-	} `json:"stripeMetaData"`
-	IsTrialAvailable        bool   `json:"isTrialAvailable"`
-	AllowAddNewSubscription bool   `json:"allowAddNewSubscription"`
-	ID                      string `json:"id"`
-	LegacySubscriptionID    string `json:"legacySubscriptionId"`
-	Status                  string `json:"status"`
-	IsContentAccessible     bool   `json:"isContentAccessible"`
-	StartedAt               string `json:"startedAt"`
-	EndsAt                  string `json:"endsAt"`
-	TrialEndsAt             string `json:"trialEndsAt"`
-	Plan                    struct {
-		ID              string      `json:"id"`
-		Price           float64     `json:"price"`
-		Period          int         `json:"period"`
-		TrialPeriodDays int         `json:"trialPeriodDays"`
-		PlanID          string      `json:"planId"`
-		Description     string      `json:"description"`
-		ServiceLevel    string      `json:"serviceLevel"`
-		StartsAt        interface{} `json:"startsAt"`
-		EndsAt          interface{} `json:"endsAt"`
-	} `json:"plan"`
-	Promo struct {
-		ID            string      `json:"id"`
-		PromoCode     string      `json:"promoCode"`
-		PromoPrice    float64     `json:"promoPrice"`
-		Description   string      `json:"description"`
-		PromoStartsAt interface{} `json:"promoStartsAt"`
-		PromoEndsAt   interface{} `json:"promoEndsAt"`
-		Plan          struct {
-			ID              string      `json:"id"`
-			Price           float64     `json:"price"`
-			Period          int         `json:"period"`
-			TrialPeriodDays int         `json:"trialPeriodDays"`
-			PlanID          string      `json:"planId"`
-			Description     string      `json:"description"`
-			ServiceLevel    string      `json:"serviceLevel"`
-			StartsAt        interface{} `json:"startsAt"`
-			EndsAt          interface{} `json:"endsAt"`
-		} `json:"plan"`
-		Gateway string `json:"gateway"`
-	}
+type ArchiveEntry struct {
+	ContainerID int    `json:"containerID"`
+	TrackID     int    `json:"trackID"`
+	Format      int    `json:"format"`
+	Path        string `json:"path"`
 }
 
-type StreamParams struct {
-	SubscriptionID          string
-	SubCostplanIDAccessList string
-	UserID                  string
-	StartStamp              string
-	EndStamp                string
+type Archive struct {
+	Tracks map[string]*ArchiveEntry `json:"tracks"`
 }
 
-type Product struct {
-	ProductStatusType    int           `json:"productStatusType"`
-	SkuIDExt             interface{}   `json:"skuIDExt"`
-	FormatStr            string        `json:"formatStr"`
-	SkuID                int           `json:"skuID"`
-	Cost                 int           `json:"cost"`
-	CostplanID           int           `json:"costplanID"`
-	Pricing              interface{}   `json:"pricing"`
-	Bundles              []interface{} `json:"bundles"`
-	NumPublicPricePoints int           `json:"numPublicPricePoints"`
-	CartLink             string        `json:"cartLink"`
-	LiveEventInfo        struct {
-		IsEventLive                  bool        `json:"isEventLive"`
-		EventID                      int         `json:"eventID"`
-		EventStartDateStr            string      `json:"eventStartDateStr"`
-		EventEndDateStr              string      `json:"eventEndDateStr"`
-		TimeZoneToDisplay            interface{} `json:"timeZoneToDisplay"`
-		OffsetFromLocalTimeToDisplay int         `json:"offsetFromLocalTimeToDisplay"`
-		UTCoffset                    int         `json:"UTCoffset"`
-		EventCode                    interface{} `json:"eventCode"`
-		LinkType                     int         `json:"linkType"`
-	} `json:"liveEventInfo"`
-	SaleWindowInfo struct {
-		IsEventSelling               bool        `json:"isEventSelling"`
-		SswID                        int         `json:"sswID"`
-		TimeZoneToDisplay            interface{} `json:"timeZoneToDisplay"`
-		OffsetFromLocalTimeToDisplay int         `json:"offsetFromLocalTimeToDisplay"`
-		SaleStartDateStr             interface{} `json:"saleStartDateStr"`
-		SaleEndDateStr               interface{} `json:"saleEndDateStr"`
-	} `json:"saleWindowInfo"`
-	IosCost         int         `json:"iosCost"`
-	IosPlanName     interface{} `json:"iosPlanName"`
-	GooglePlanName  interface{} `json:"googlePlanName"`
-	GoogleCost      int         `json:"googleCost"`
-	NumDiscs        int         `json:"numDiscs"`
-	IsSubStreamOnly int         `json:"isSubStreamOnly"`
+type ListResult struct {
+	Kind  string
+	Title string
+	ID    int
+	URL   string
 }
 
-type ProductFormatList struct {
-	PfType     int    `json:"pfType"`
-	FormatStr  string `json:"formatStr"`
-	SkuID      int    `json:"skuID"`
-	Cost       int    `json:"cost"`
-	CostplanID int    `json:"costplanID"`
-	PfTypeStr  string `json:"pfTypeStr"`
-	LiveEvent  struct {
-		EventID                      int         `json:"eventID"`
-		EventStartDateStr            interface{} `json:"eventStartDateStr"`
-		EventEndDateStr              interface{} `json:"eventEndDateStr"`
-		TimeZoneToDisplay            interface{} `json:"timeZoneToDisplay"`
-		OffsetFromLocalTimeToDisplay int         `json:"offsetFromLocalTimeToDisplay"`
-		UTCoffset                    int         `json:"UTCoffset"`
-		EventCode                    interface{} `json:"eventCode"`
-		LinkType                     int         `json:"linkType"`
-	} `json:"liveEvent"`
-	Salewindow struct {
-		SswID                        int         `json:"sswID"`
-		TimeZoneToDisplay            interface{} `json:"timeZoneToDisplay"`
-		OffsetFromLocalTimeToDisplay int         `json:"offsetFromLocalTimeToDisplay"`
-		SaleStartDateStr             interface{} `json:"saleStartDateStr"`
-		SaleEndDateStr               interface{} `json:"saleEndDateStr"`
-	} `json:"salewindow"`
-	SkuCode         string `json:"skuCode"`
-	IsSubStreamOnly int    `json:"isSubStreamOnly"`
+type ExportRow struct {
+	ContainerID          int    `json:"containerID"`
+	ArtistName           string `json:"artistName"`
+	ContainerInfo        string `json:"containerInfo"`
+	ContainerType        string `json:"containerType"`
+	PerformanceDate      string `json:"performanceDate"`
+	VenueName            string `json:"venueName"`
+	VenueCity            string `json:"venueCity"`
+	VenueState           string `json:"venueState"`
+	ContainerRunningTime int    `json:"containerRunningTime"`
+	Notes                string `json:"notes"`
+	TrackID              int    `json:"trackID"`
+	SongID               int    `json:"songID"`
+	DiscNum              int    `json:"discNum"`
+	SetNum               int    `json:"setNum"`
+	TrackNum             int    `json:"trackNum"`
+	SongTitle            string `json:"songTitle"`
+	RunningTime          int    `json:"runningTime"`
 }
 
-type AlbArtResp struct {
-	NumReviews                int         `json:"numReviews"`
-	TotalContainerRunningTime int         `json:"totalContainerRunningTime"`
-	HhmmssTotalRunningTime    string      `json:"hhmmssTotalRunningTime"`
-	Products                  []Product   `json:"products"`
-	Subscriptions             interface{} `json:"subscriptions"`
-	Tracks                    []Track     `json:"tracks"`
-	Pics                      []struct {
-		PicID   int    `json:"picID"`
-		OrderID int    `json:"orderID"`
-		Height  int    `json:"height"`
-		Width   int    `json:"width"`
-		Caption string `json:"caption"`
-		URL     string `json:"url"`
-	} `json:"pics"`
-	Recommendations []interface{} `json:"recommendations"`
-	Reviews         struct {
-		ContainerID int `json:"containerID"`
-		Items       []struct {
-			ReviewStatus    int    `json:"reviewStatus"`
-			ReviewStatusStr string `json:"reviewStatusStr"`
-			ContainerID     int    `json:"containerID"`
-			ReviewID        int    `json:"reviewID"`
-			ReviewerName    string `json:"reviewerName"`
-			ReviewDate      string `json:"reviewDate"`
-			Review          string `json:"review"`
-		} `json:"items"`
-		IsMoreRecords bool `json:"isMoreRecords"`
-		TotalPages    int  `json:"totalPages"`
-		TotalRecords  int  `json:"totalRecords"`
-		NumPerPage    int  `json:"numPerPage"`
-		PageNum       int  `json:"pageNum"`
-	} `json:"reviews"`
-	Notes []struct {
-		NoteID int    `json:"noteID"`
-		Note   string `json:"note"`
-	} `json:"notes"`
-	CategoryID       int         `json:"categoryID"`
-	Labels           interface{} `json:"labels"`
-	PrevContainerID  int         `json:"prevContainerID"`
-	NextContainerID  int         `json:"nextContainerID"`
-	PrevContainerURL string      `json:"prevContainerURL"`
-	NextContainerURL string      `json:"nextContainerURL"`
-	VolumeName       string      `json:"volumeName"`
-	CdArtWorkList    []struct {
-		DiscNumber     int    `json:"discNumber"`
-		ArtWorkType    int    `json:"artWorkType"`
-		ArtWorkTypeStr string `json:"artWorkTypeStr"`
-		TemplateType   int    `json:"templateType"`
-		ArtWorkPath    string `json:"artWorkPath"`
-	} `json:"cdArtWorkList"`
-	ContainerGroups         interface{}   `json:"containerGroups"`
-	VideoURL                interface{}   `json:"videoURL"`
-	VideoImage              interface{}   `json:"videoImage"`
-	VideoTitle              interface{}   `json:"videoTitle"`
-	VideoDesc               interface{}   `json:"videoDesc"`
-	VodPlayerImage          string        `json:"vodPlayerImage"`
-	IsInSubscriptionProgram bool          `json:"isInSubscriptionProgram"`
-	SvodskuID               int           `json:"svodskuID"`
-	LicensorName            string        `json:"licensorName"`
-	AffID                   int           `json:"affID"`
-	PageURL                 string        `json:"pageURL"`
-	CoverImage              interface{}   `json:"coverImage"`
-	VenueName               string        `json:"venueName"`
-	VenueCity               string        `json:"venueCity"`
-	VenueState              string        `json:"venueState"`
-	ArtistName              string        `json:"artistName"`
-	AccessList              []interface{} `json:"accessList"`
-	AvailabilityType        int           `json:"availabilityType"`
-	AvailabilityTypeStr     string        `json:"availabilityTypeStr"`
-	Venue                   string        `json:"venue"`
-	Img                     struct {
-		PicID   int    `json:"picID"`
-		OrderID int    `json:"orderID"`
-		Height  int    `json:"height"`
-		Width   int    `json:"width"`
-		Caption string `json:"caption"`
-		URL     string `json:"url"`
-	} `json:"img"`
-	ContainerID                   int                  `json:"containerID"`
-	ContainerInfo                 string               `json:"containerInfo"`
-	PerformanceDate               string               `json:"performanceDate"`
-	PerformanceDateFormatted      string               `json:"performanceDateFormatted"`
-	PerformanceDateYear           string               `json:"performanceDateYear"`
-	PerformanceDateShort          string               `json:"performanceDateShort"`
-	PerformanceDateShortYearFirst string               `json:"performanceDateShortYearFirst"`
-	PerformanceDateAbbr           string               `json:"performanceDateAbbr"`
-	SongList                      interface{}          `json:"songList"`
-	ReleaseDate                   interface{}          `json:"releaseDate"`
-	ReleaseDateFormatted          string               `json:"releaseDateFormatted"`
-	ActiveState                   string               `json:"activeState"`
-	ContainerType                 int                  `json:"containerType"`
-	ContainerTypeStr              string               `json:"containerTypeStr"`
-	Songs                         []Track              `json:"songs"`
-	SalesLast30                   int                  `json:"salesLast30"`
-	SalesAllTime                  int                  `json:"salesAllTime"`
-	DateCreated                   string               `json:"dateCreated"`
-	EpochDateCreated              float64              `json:"epochDateCreated"`
-	ProductFormatList             []*ProductFormatList `json:"productFormatList"`
-	ContainsPreviewVideo          int                  `json:"containsPreviewVideo"`
-	ArtistID                      int                  `json:"artistID"`
-	ContainerCategoryID           int                  `json:"containerCategoryID"`
-	ContainerCategoryName         interface{}          `json:"containerCategoryName"`
-	ContainerCode                 string               `json:"containerCode"`
-	ContainerIDExt                interface{}          `json:"containerIDExt"`
-	ExtImage                      string               `json:"extImage"`
-	VideoChapters                 []interface{}        `json:"videoChapters"`
+type ContainerFilter struct {
+	Since         time.Time
+	Until         time.Time
+	Year          int
+	VenueContains string
+	State         string
+	ContainerType string
 }
 
-type AlbumMeta struct {
-	MethodName                  string     `json:"methodName"`
-	ResponseAvailabilityCode    int        `json:"responseAvailabilityCode"`
-	ResponseAvailabilityCodeStr string     `json:"responseAvailabilityCodeStr"`
-	Response                    *AlbArtResp `json:"Response"`
+type Session struct {
+	Token        string
+	StreamParams *nugs.StreamParams
+	LegacyToken  string
+	UguID        string
+	PlanDesc     string
 }
 
-type Token struct {
-	MethodName string `json:"methodName"`
-	Response   struct {
-		TokenValue     string      `json:"tokenValue"`
-		ReturnCode     int         `json:"returnCode"`
-		ReturnCodeStr  string      `json:"returnCodeStr"`
-		NnCustomerAuth interface{} `json:"nnCustomerAuth"`
-	} `json:"Response"`
-	ResponseAvailabilityCode    int    `json:"responseAvailabilityCode"`
-	ResponseAvailabilityCodeStr string `json:"responseAvailabilityCodeStr"`
-	SessionState                int    `json:"sessionState"`
-	SessionStateStr             string `json:"sessionStateStr"`
+type ArtistSyncState struct {
+	ContainerID      int     `json:"containerID"`
+	DateCreated      string  `json:"dateCreated"`
+	EpochDateCreated float64 `json:"epochDateCreated"`
 }
 
-type PlistMeta struct {
-	MethodName string `json:"methodName"`
-	Response   struct {
-		TotalRunningTime       int    `json:"totalRunningTime"`
-		HhmmssTotalRunningTime string `json:"hhmmssTotalRunningTime"`
-		ID                     int    `json:"ID"`
-		UserID                 int    `json:"userID"`
-		Items                  []struct {
-			ID                int   `json:"ID"`
-			OrderID           int   `json:"orderID"`
-			Track             Track `json:"track"`
-			PlaylistContainer struct {
-				TotalRunningTime       int         `json:"totalRunningTime"`
-				HhmmssTotalRunningTime interface{} `json:"hhmmssTotalRunningTime"`
-				Img                    struct {
-					PicID   int    `json:"picID"`
-					OrderID int    `json:"orderID"`
-					Height  int    `json:"height"`
-					Width   int    `json:"width"`
-					Caption string `json:"caption"`
-					URL     string `json:"url"`
-				} `json:"img"`
-				ContainerInfo          string      `json:"containerInfo"`
-				Products               []Product   `json:"products"`
-				VenueName              string      `json:"venueName"`
-				VenueCity              string      `json:"venueCity"`
-				VenueState             string      `json:"venueState"`
-				ArtistName             string      `json:"artistName"`
-				Venue                  string      `json:"venue"`
-				ContainerID            int         `json:"containerID"`
-				PerformanceDate        string      `json:"performanceDate"`
-				ReleaseDate            interface{} `json:"releaseDate"`
-				ContainerType          int         `json:"containerType"`
-				ArtistID               int         `json:"artistID"`
-				TitleType              int         `json:"titleType"`
-				StrTotalRunningTime    string      `json:"strTotalRunningTime"`
-				ContainerCategoryID    int         `json:"containerCategoryID"`
-				ContainerCategoryName  interface{} `json:"containerCategoryName"`
-				ContainerCategoryOrder int         `json:"containerCategoryOrder"`
-				Availability           int         `json:"availability"`
-				TicketImage            interface{} `json:"ticketImage"`
-				UnavailableNote        interface{} `json:"unavailableNote"`
-				Numasterisks           string      `json:"numasterisks"`
-				CoverImage             interface{} `json:"coverImage"`
-			} `json:"playlistContainer"`
-		} `json:"items"`
-		CreateDate          interface{} `json:"createDate"`
-		PlayListName        string      `json:"playListName"`
-		AlreadyExistsFlag   bool        `json:"alreadyExistsFlag"`
-		PlayListUserInvalid bool        `json:"playListUserInvalid"`
-		PlaylistImage       interface{} `json:"playlistImage"`
-		NumTracks           int         `json:"numTracks"`
-		GeneratedGUID       interface{} `json:"generatedGUID"`
-		ShortenedLink       interface{} `json:"shortenedLink"`
-	} `json:"Response"`
-	ResponseAvailabilityCode    int    `json:"responseAvailabilityCode"`
-	ResponseAvailabilityCodeStr string `json:"responseAvailabilityCodeStr"`
-	SessionState                int    `json:"sessionState"`
-	SessionStateStr             string `json:"sessionStateStr"`
+type SyncState struct {
+	Artists map[string]*ArtistSyncState `json:"artists"`
 }
 
-type Track struct {
-	AccessList             []interface{} `json:"accessList"`
-	HhmmssTotalRunningTime string        `json:"hhmmssTotalRunningTime"`
-	TrackLabel             string        `json:"trackLabel"`
-	TrackURL               string        `json:"trackURL"`
-	SongID                 int           `json:"songID"`
-	SongTitle              string        `json:"songTitle"`
-	TotalRunningTime       int           `json:"totalRunningTime"`
-	DiscNum                int           `json:"discNum"`
-	TrackNum               int           `json:"trackNum"`
-	SetNum                 int           `json:"setNum"`
-	ClipURL                string        `json:"clipURL"`
-	TrackID                int           `json:"trackID"`
-	TrackExclude           int           `json:"trackExclude"`
-	Rootpath               interface{}   `json:"rootpath"`
-	SourcePath             interface{}   `json:"sourcePath"`
-	SourceFilename         interface{}   `json:"sourceFilename"`
-	SourceFilePath         interface{}   `json:"sourceFilePath"`
-	RootPathReal           interface{}   `json:"rootPathReal"`
-	SourceFilePathReal     interface{}   `json:"sourceFilePathReal"`
-	SkuIDExt               interface{}   `json:"skuIDExt"`
-	TransportMethod        string        `json:"transportMethod"`
-	StrTotalRunningTime    interface{}   `json:"strTotalRunningTime"`
-	Products               []Product     `json:"products"`
-	Subscriptions          interface{}   `json:"subscriptions"`
-	AudioProduct           interface{}   `json:"audioProduct"`
-	AudioLosslessProduct   interface{}   `json:"audioLosslessProduct"`
-	AudioHDProduct         interface{}   `json:"audioHDProduct"`
-	VideoProduct           interface{}   `json:"videoProduct"`
-	LivestreamProduct      interface{}   `json:"livestreamProduct"`
-	Mp4Product             interface{}   `json:"mp4Product"`
-	VideoondemandProduct   interface{}   `json:"videoondemandProduct"`
-	CdProduct              interface{}   `json:"cdProduct"`
-	LiveHDstreamProduct    interface{}   `json:"liveHDstreamProduct"`
-	HDvideoondemandProduct interface{}   `json:"HDvideoondemandProduct"`
-	VinylProduct           interface{}   `json:"vinylProduct"`
-	DsdProduct             interface{}   `json:"dsdProduct"`
-	DvdProduct             interface{}   `json:"dvdProduct"`
-	Reality360Product      interface{}   `json:"reality360Product"`
-	ContainerGroups        interface{}   `json:"containerGroups"`
-	IDList                 string        `json:"IDList"`
-	PlayListID             int           `json:"playListID"`
-	CatalogQueryType       int           `json:"catalogQueryType"`
+// Maps track IDs to their file names in a mirrored playlist's folder.
+type PlistState struct {
+	Tracks map[string]string `json:"tracks"`
 }
 
-type StreamMeta struct {
-	StreamLink         string      `json:"streamLink"`
-	Streamer           string      `json:"streamer"`
-	UserID             string      `json:"userID"`
-	Mason              interface{} `json:"mason"`
-	SubContentAccess   int         `json:"subContentAccess"`
-	StashContentAccess int         `json:"stashContentAccess"`
+type SegPlaylist struct {
+	SegUrls        []string
+	SeqNo          uint64
+	TargetDuration time.Duration
+	Ended          bool
+}
+
+type ScanResult struct {
+	Matched    bool
+	Missing    int
+	Partial    int
+	Upgradable int
+}
+
+type TrackTags struct {
+	Artist string
+	Album  string
+	Date   string
+	Title  string
+}
+
+type FlacStreamInfo struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+	TotalSamples  int64
+	MD5           string
 }
 
 type Quality struct {
@@ -448,24 +266,34 @@ type Quality struct {
 	Format    int
 }
 
-type ArtistMeta struct {
-	MethodName                  string `json:"methodName"`
-	ResponseAvailabilityCode    int    `json:"responseAvailabilityCode"`
-	ResponseAvailabilityCodeStr string `json:"responseAvailabilityCodeStr"`
-	Response                    struct {
-		HeaderName          interface{}   `json:"headerName"`
-		Packages            interface{}   `json:"packages"`
-		Containers          []*AlbArtResp `json:"containers"`
-		CategoryID          int           `json:"categoryID"`
-		ArtistID            int           `json:"artistID"`
-		ArtistName          interface{}   `json:"artistName"`
-		LoadingState        int           `json:"loadingState"`
-		TotalMatchedRecords int           `json:"totalMatchedRecords"`
-		NnCheckSum          int           `json:"nnCheckSum"`
-	} `json:"Response"`
+type NfoThumb struct {
+	Aspect string `xml:"aspect,attr,omitempty"`
+	Value  string `xml:",chardata"`
 }
 
-type PurchasedManResp struct {
-	FileURL      string `json:"fileURL"`
-	ResponseCode int    `json:"responseCode"`
-}
\ No newline at end of file
+type NfoFanart struct {
+	Thumbs []NfoThumb `xml:"thumb"`
+}
+
+type NfoUniqueID struct {
+	Type    string `xml:"type,attr"`
+	Default bool   `xml:"default,attr"`
+	Value   string `xml:",chardata"`
+}
+
+type VideoNfo struct {
+	XMLName   xml.Name
+	Title     string      `xml:"title"`
+	Artist    string      `xml:"artist,omitempty"`
+	Album     string      `xml:"album,omitempty"`
+	Director  string      `xml:"director,omitempty"`
+	Premiered string      `xml:"premiered,omitempty"`
+	Year      int         `xml:"year,omitempty"`
+	Plot      string      `xml:"plot,omitempty"`
+	Studio    string      `xml:"studio"`
+	Runtime   int         `xml:"runtime,omitempty"`
+	UniqueID  NfoUniqueID `xml:"uniqueid"`
+	Tags      []string    `xml:"tag"`
+	Thumbs    []NfoThumb  `xml:"thumb"`
+	Fanart    *NfoFanart  `xml:"fanart"`
+}